@@ -5,14 +5,16 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"strconv"
 	"github.com/stowage/sketchmerge"
 	_"path/filepath"
-	_"encoding/json"
+	"encoding/json"
 )
 
 const (
 	MergeOpType = iota
 	DiffOpType
+	Merge3OpType
 )
 
 
@@ -22,25 +24,73 @@ func main() {
 		fmt.Printf("Usage of %s:\n", os.Args[0])
 		fmt.Printf("    sketchmerge diff [optional] <merge_file> src_file_or_dir dst_file_or_dir ...\n")
 		fmt.Printf("    sketchmerge merge -o <output dir> <merge_file> src_file_or_dir dst_file_or_dir ...\n")
+		fmt.Printf("    sketchmerge merge3 -o <output dir> base_file_or_dir ours_file_or_dir theirs_file_or_dir ...\n")
 		fmt.Printf("\n")
 		fmt.Printf("	Operations:\n")
 		fmt.Printf("	  diff - show difference of src and dst file\n")
 		fmt.Printf("	  merge - merge items using merge_file from src and dst file\n")
+		fmt.Printf("	  merge3 - merge changes of ours and theirs file made since their common base file,\n")
+		fmt.Printf("	           conflicts are written to <ours name>.conflicts.json in output dir\n")
 		fmt.Printf("\n")
 		fmt.Printf("	Optional parameters for 'diff' operation:\n")
 		fmt.Printf("	  --file-output=<path to file> (-f <path to file>) - output difference to file\n")
 		fmt.Printf("	  --nice-description (-n) - analyze difference and provide natural language description\n")
+		fmt.Printf("	  --values (-v) - embed src and dst values of changed nodes, large subtrees by hash\n")
+		fmt.Printf("	  --moves (-m) - report objects moved to another group as moves instead of delete and add\n")
+		fmt.Printf("	  --lcs (-l) - match elements of arrays without object key by longest common subsequence instead of index\n")
+		fmt.Printf("	  --tolerance=<epsilon> (-t <epsilon>) - compare numbers numerically and ignore changes within epsilon\n")
+		fmt.Printf("	  --tolerance=<key pattern>:<epsilon> - epsilon for keys matching pattern, e.g. frame.*:0.001, points:0.01, rotation:0.1\n")
+		fmt.Printf("	  --config=<path to file> (-c <path to file>) - read compare options and include and exclude rules from config file\n")
 		fmt.Printf("	  (NOT IMPLEMENTED)--dependencies (-d) analyze objects dependencies\n")
 		fmt.Printf("\n")
-		fmt.Printf("	Required parameters for 'merge' operations:\n")
+		fmt.Printf("	Required parameters for 'merge' and 'merge3' operations:\n")
 		fmt.Printf("	  --output=<path to dir> (-o <path to dir>) - output resulting sketch file to dir\n")
 		fmt.Printf("\n")
+		fmt.Printf("	Optional parameters for 'merge' operation:\n")
+		fmt.Printf("	  --dry-run - apply merge file in memory without writing files, output resulting documents and per-action report\n")
+		fmt.Printf("	  --config=<path to file> (-c <path to file>) - skip differences of nodes excluded by rules of config file\n")
+		fmt.Printf("\n")
+		fmt.Printf("	Optional parameters for 'merge3' operation:\n")
+		fmt.Printf("	  --strategy=<ours|theirs|union|newest> (-s <strategy>) - resolve conflicts by strategy, ours by default\n")
+		fmt.Printf("	  --policy=<path to file> (-p <path to file>) - resolve conflicts by strategies of policy file\n")
+		fmt.Printf("\n")
+		fmt.Printf("	Policy file format:\n")
+		fmt.Printf(`		{
+			  "default": "ours",
+			  "rules": [
+			    {"key": "style", "strategy": "theirs"},
+			    {"key": "frame", "strategy": "ours"},
+			    {"class": "text", "strategy": "newest"},
+			    {"path": "^\\$\\[\"layers\"\\]\\[0\\]\\[\"layers\"\\]$", "strategy": "union"}
+			  ]
+		}
+		`)
+		fmt.Printf("\n")
+		fmt.Printf("	Config file format:\n")
+		fmt.Printf(`		{
+			  "moves": true,
+			  "tolerance": 0.0001,
+			  "key_tolerances": {"frame.*": 0.001, "rotation": 0.1},
+			  "exclude": [
+			    {"key": "userInfo"},
+			    {"key": "saveHistory"},
+			    {"path": "$[\"created\"]"},
+			    {"class": "MSImmutableForeignSymbol"}
+			  ],
+			  "include": [
+			    {"path": "$..layers"}
+			  ]
+		}
+		`)
+		fmt.Printf("\n")
 		fmt.Printf("	Merge file format <merge_file>:\n")
+		fmt.Printf("	  file_copy_action: 0 - merge file_diff, 1 - file only in src is copied to dst, 2 - file only in dst is removed\n")
 		fmt.Printf(`		{
 			  "merge_actions": [
 			    {
 			      "file_key": "pages/892342FF-2A18-4BFC-9124-28AF6F0D3CEE.json",
-			      "action": 1,
+			      "file_ext": ".json",
+			      "file_copy_action": 0,
 			      "file_diff": {
 				"src_to_dst_diff": {
 				  "$[\"layers\"][0][\"layers\"][0][\"frame\"][\"x\"]": "$[\"layers\"][0][\"layers\"][0][\"frame\"][\"x\"]",
@@ -79,6 +129,14 @@ func main() {
 	case "merge":
 		opType = MergeOpType
 
+		if flag.NArg() < 4 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		break
+	case "merge3":
+		opType = Merge3OpType
+
 		if flag.NArg() < 4 {
 			flag.Usage()
 			os.Exit(1)
@@ -92,11 +150,28 @@ func main() {
 	if opType == DiffOpType {
 		files := make([]string,0)
 		outputToFile := ""
+		configFile := ""
 		isNice := false
+		var options sketchmerge.CompareOptions
 		for argc := 1; argc < flag.NArg(); argc++ {
 			switch flag.Arg(argc) {
+			case "-c", "--config":
+				argc++
+				configFile = flag.Arg(argc)
 			case "-n", "--nice-description":
 				isNice = true
+			case "-v", "--values":
+				options.WithValues = true
+			case "-m", "--moves":
+				options.DetectMoves = true
+			case "-l", "--lcs":
+				options.LCSMatching = true
+			case "-t", "--tolerance":
+				argc++
+				if err := setTolerance(&options, flag.Arg(argc)); err != nil {
+					fmt.Printf("Error occured: %v\n", err)
+					os.Exit(1)
+				}
 			case "-d", "--dependencies":
 				break
 			case "-f", "--file-output":
@@ -105,6 +180,13 @@ func main() {
 			default:
 				if strings.HasPrefix(flag.Arg(argc), "--file-output=") {
 					outputToFile = strings.TrimPrefix(flag.Arg(argc), "--file-output=")
+				} else if strings.HasPrefix(flag.Arg(argc), "--config=") {
+					configFile = strings.TrimPrefix(flag.Arg(argc), "--config=")
+				} else if strings.HasPrefix(flag.Arg(argc), "--tolerance=") {
+					if err := setTolerance(&options, strings.TrimPrefix(flag.Arg(argc), "--tolerance=")); err != nil {
+						fmt.Printf("Error occured: %v\n", err)
+						os.Exit(1)
+					}
 				} else {
 					files = append(files, flag.Arg(argc))
 				}
@@ -116,7 +198,16 @@ func main() {
 			os.Exit(1)
 		}
 
-		mergeInfo, err := sketchmerge.ProcessFileDiff(files[0], files[1], isNice)
+		if configFile != "" {
+			config, err := withConfig(configFile, options)
+			if err != nil {
+				fmt.Printf("Error occured: %v\n", err)
+				os.Exit(1)
+			}
+			options = config
+		}
+
+		mergeInfo, err := sketchmerge.ProcessFileDiff(files[0], files[1], isNice, options)
 		if err!=nil {
 			fmt.Printf("Error occured: %v\n", err)
 			os.Exit(1)
@@ -134,15 +225,24 @@ func main() {
 	if opType == MergeOpType {
 		files := make([]string,0)
 		outputToDir := ""
+		configFile := ""
+		isDryRun := false
 		for argc := 1; argc < flag.NArg(); argc++ {
 			switch flag.Arg(argc) {
 			case "-o", "--output":
 				argc++
 				outputToDir = flag.Arg(argc)
 				break
+			case "-c", "--config":
+				argc++
+				configFile = flag.Arg(argc)
+			case "--dry-run":
+				isDryRun = true
 			default:
 				if strings.HasPrefix(flag.Arg(argc), "--output=") {
 					outputToDir = strings.TrimPrefix(flag.Arg(argc), "--output=")
+				} else if strings.HasPrefix(flag.Arg(argc), "--config=") {
+					configFile = strings.TrimPrefix(flag.Arg(argc), "--config=")
 				} else {
 					files = append(files, flag.Arg(argc))
 				}
@@ -165,18 +265,175 @@ func main() {
 
 		isDstDir := sketchFileV2Info.IsDir()
 
-		if !isDstDir && outputToDir == "" {
+		if !isDstDir && !isDryRun && outputToDir == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		options := sketchmerge.MergeOptions{DryRun: isDryRun}
+		if configFile != "" {
+			config, err := sketchmerge.LoadCompareOptions(configFile)
+			if err != nil {
+				fmt.Printf("Error occured: %v\n", err)
+				os.Exit(1)
+			}
+			options.Compare = config
+		}
+
+		report, err := sketchmerge.ProcessFileMerge(files[0], files[1], files[2], outputToDir, options)
+
+		if err!=nil {
+			fmt.Printf("Error occured: %v\n", err)
+			os.Exit(1)
+		}
+
+		if isDryRun {
+			reportInfo, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Printf("Error occured: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(reportInfo))
+		}
+
+		if report.HasFailures() {
+			for _, failure := range report.Failures() {
+				fmt.Printf("Failed: %v\n", failure)
+			}
+			fmt.Printf("Merge failed, no files written: %v applied, %v skipped, %v failed\n", report.Count(sketchmerge.ActionApplied), report.Count(sketchmerge.ActionSkipped), report.Count(sketchmerge.ActionFailed))
+			os.Exit(1)
+		}
+
+	}
+
+	if opType == Merge3OpType {
+		files := make([]string,0)
+		outputToDir := ""
+		policyFile := ""
+		strategy := ""
+		for argc := 1; argc < flag.NArg(); argc++ {
+			switch flag.Arg(argc) {
+			case "-o", "--output":
+				argc++
+				outputToDir = flag.Arg(argc)
+				break
+			case "-p", "--policy":
+				argc++
+				policyFile = flag.Arg(argc)
+			case "-s", "--strategy":
+				argc++
+				strategy = flag.Arg(argc)
+			default:
+				if strings.HasPrefix(flag.Arg(argc), "--output=") {
+					outputToDir = strings.TrimPrefix(flag.Arg(argc), "--output=")
+				} else if strings.HasPrefix(flag.Arg(argc), "--policy=") {
+					policyFile = strings.TrimPrefix(flag.Arg(argc), "--policy=")
+				} else if strings.HasPrefix(flag.Arg(argc), "--strategy=") {
+					strategy = strings.TrimPrefix(flag.Arg(argc), "--strategy=")
+				} else {
+					files = append(files, flag.Arg(argc))
+				}
+			}
+
+		}
+
+
+		if len(files) != 3 {
+			flag.Usage()
+			os.Exit(1)
+		}
+
+		sketchFileOursInfo, errOurs := os.Stat(files[1])
+
+		if errOurs != nil {
+			fmt.Printf("Error occured: %v\n", errOurs)
+			os.Exit(1)
+		}
+
+		isOursDir := sketchFileOursInfo.IsDir()
+
+		if !isOursDir && outputToDir == "" {
 			flag.Usage()
 			os.Exit(1)
 		}
 
-		err := sketchmerge.ProcessFileMerge(files[0], files[1], files[2], outputToDir )
+		policy := new(sketchmerge.MergePolicy)
+
+		if policyFile != "" {
+			var err error
+			policy, err = sketchmerge.LoadMergePolicy(policyFile)
+			if err != nil {
+				fmt.Printf("Error occured: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if strategy != "" {
+			policy.Default = sketchmerge.ResolutionStrategy(strategy)
+			if err := policy.Compile(); err != nil {
+				fmt.Printf("Error occured: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		conflicts, err := sketchmerge.ProcessFileMerge3(files[0], files[1], files[2], outputToDir, policy)
 
 		if err!=nil {
 			fmt.Printf("Error occured: %v\n", err)
 			os.Exit(1)
 		}
 
+		if len(conflicts) > 0 {
+			fmt.Printf("Merged with %v conflicts\n", len(conflicts))
+		}
+
+	}
+}
+
+//Sets global epsilon or epsilon of key pattern given as <key pattern>:<epsilon>
+func setTolerance(options *sketchmerge.CompareOptions, value string) error {
+	pattern := ""
+	if i := strings.LastIndex(value, ":"); i != -1 {
+		pattern, value = value[:i], value[i+1:]
+	}
+
+	epsilon, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+
+	if pattern == "" {
+		options.Tolerance = epsilon
+		return nil
 	}
+
+	if options.KeyTolerances == nil {
+		options.KeyTolerances = make(map[string]float64)
+	}
+	options.KeyTolerances[pattern] = epsilon
+	return nil
 }
 
+//Reads compare options from config file, options given by flags override the config
+func withConfig(configFile string, flags sketchmerge.CompareOptions) (sketchmerge.CompareOptions, error) {
+	options, err := sketchmerge.LoadCompareOptions(configFile)
+	if err != nil {
+		return options, err
+	}
+
+	options.WithValues = options.WithValues || flags.WithValues
+	options.DetectMoves = options.DetectMoves || flags.DetectMoves
+	options.LCSMatching = options.LCSMatching || flags.LCSMatching
+
+	if flags.Tolerance != 0 {
+		options.Tolerance = flags.Tolerance
+	}
+
+	for pattern, epsilon := range flags.KeyTolerances {
+		if options.KeyTolerances == nil {
+			options.KeyTolerances = make(map[string]float64)
+		}
+		options.KeyTolerances[pattern] = epsilon
+	}
+	return options, nil
+}
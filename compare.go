@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"strings"
 	"encoding/json"
-	"strconv"
 	_ "github.com/NodePrime/jsonpath"
 	"github.com/mohae/deepcopy"
 	_ "github.com/pquerna/ffjson/ffjson"
@@ -17,7 +16,6 @@ import (
 	"time"
 	"log"
 	_ "sync"
-	"reflect"
 )
 
 // Structure of sketch folder
@@ -29,7 +27,8 @@ type SketchFileStruct struct {
 // Sketch file structure comparison
 type FileActionType uint8
 
-//File structure merge actions
+//File structure merge actions, they describe changes of base file set into new one
+//Merge of base into new set reverts them: DELETE files are copied from src, ADD files are removed from dst
 const (
 	MERGE = iota
 	DELETE
@@ -51,9 +50,50 @@ type FileMerge struct {
 //File structure merge actions (all)
 type FileStructureMerge struct {
 	MergeActions []FileMerge `json:"merge_actions"`
+	//objects moved between files
+	FileMoves []FileMove `json:"file_moves,omitempty"`
+	//differences of arrays without object key were found by longest common subsequence, so merge inserts their adds at src index
+	LCSMatching bool `json:"lcs_matching,omitempty"`
 }
 
 
+//Options of json documents comparison
+type CompareOptions struct {
+	//address array elements having object key by its value, e.g. [?do_objectID=="..."], instead of index
+	//JSON Pointer has no such selector, so the option is ignored for JSONPointerFormat
+	ObjectIDPaths bool `json:"object_id_paths,omitempty"`
+
+	//format of paths in differences, jsonpath by default
+	PathFormat PathFormat `json:"path_format,omitempty"`
+
+	//embed values of changed nodes into DiffValues
+	WithValues bool `json:"values,omitempty"`
+
+	//subtrees with json encoding larger than MaxValueSize are embedded by hash, DefaultMaxValueSize if not set
+	MaxValueSize int `json:"max_value_size,omitempty"`
+
+	//report objects moved to another container as moves instead of delete and add
+	DetectMoves bool `json:"moves,omitempty"`
+
+	//nodes to compare with their subtrees, everything is compared if empty
+	Include []CompareRule `json:"include,omitempty"`
+
+	//nodes skipped with their subtrees, exclude rules win over include rules
+	Exclude []CompareRule `json:"exclude,omitempty"`
+
+	//compare numbers numerically and ignore changes not larger than epsilon
+	Tolerance float64 `json:"tolerance,omitempty"`
+
+	//epsilon per dot separated key pattern, e.g. frame.*, points, rotation, overrides Tolerance for matched keys
+	KeyTolerances map[string]float64 `json:"key_tolerances,omitempty"`
+
+	//match elements of arrays without identity by longest common subsequence instead of index
+	LCSMatching bool `json:"lcs_matching,omitempty"`
+
+	//identities of array elements taking precedence over DefaultIdentities, elements of other arrays are matched by object key
+	Identities []ArrayIdentity `json:"-"`
+}
+
 //Difference of two json documents in jsonpath notations
 type JsonStructureCompare struct {
 	//differences for doc1 vs doc2 in jsonpath request
@@ -83,6 +123,33 @@ type JsonStructureCompare struct {
 	//Dependent objects for dst document
 	DepDoc2 * DependentObjects `json:"dep_dst,omitempty"`
 
+	//values of nodes before and after the change for src to dst differences
+	DiffValues map[string]DiffValue `json:"src_to_dst_values,omitempty"`
+
+	//objects moved to another container, path in doc1 to path in doc2
+	Doc1MoveDiffs map[string]interface{} `json:"src_to_dst_move_diff,omitempty"`
+
+	//objects moved to another container, path in doc2 to path in doc1
+	Doc2MoveDiffs map[string]interface{} `json:"dst_to_src_move_diff,omitempty"`
+
+	//comparison options
+	Options CompareOptions `json:"-"`
+
+	//containers in doc2 the moved objects were added to before move detection
+	moveParents map[string]string
+
+	//include and exclude rules of the comparison
+	filter *compareFilter
+
+	//identities of array elements and paths of arrays selected by their path patterns
+	identities []ArrayIdentity
+	identityPaths [][2]map[string]bool
+
+	//_class values of objects on the path of compared node, empty for arrays
+	classes []string
+
+	//fingerprints of maps and arrays of compared documents
+	fingerprints map[containerKey]fingerprint
 }
 
 //Getting file structure of two dirs
@@ -159,6 +226,10 @@ func (jsc * JsonStructureCompare) CompareProperties(doc1TreeMap map[string]inter
 	doc1ObjectKeyValue := doc1TreeMap[jsc.ObjectKeyName];
 	doc2ObjectKeyValue := doc2TreeMap[jsc.ObjectKeyName];
 
+	class, _ := doc1TreeMap["_class"].(string)
+	jsc.classes = append(jsc.classes, class)
+	defer func() { jsc.classes = jsc.classes[:len(jsc.classes) - 1] }()
+
 	if doc1ObjectKeyValue != nil && doc2ObjectKeyValue != nil {
 		if doc1ObjectKeyValue != doc2ObjectKeyValue || pathDoc1 != pathDoc2 {
 			jsc.addDoc1ObjectRelocated(doc1ObjectKeyValue.(string), pathDoc1, "CompareProperties");
@@ -172,15 +243,19 @@ func (jsc * JsonStructureCompare) CompareProperties(doc1TreeMap map[string]inter
 
 
 		if subtree, ok := doc2TreeMap[key]; ok {
+			jsonpathDoc1 := jsc.keyPath(pathDoc1, key)
+			jsonpathDoc2 := jsc.keyPath(pathDoc2, key)
+			state := jsc.filter.state(key, item, subtree, jsonpathDoc1, jsonpathDoc2)
+
 			//if it has a difference append to difference map
-			if __jsonpath1, __jsonpath2 ,ok := jsc.CompareDocuments(&item, &subtree, pathDoc1  + `["` + key + `"]`, pathDoc2  + `["` + key + `"]`); !ok {
+			if __jsonpath1, __jsonpath2 ,ok := jsc.compareChild(state, &item, &subtree, jsonpathDoc1, jsonpathDoc2); !ok {
 				jsc.addDoc1Diff(__jsonpath1, __jsonpath2, "CompareProperties")
 				jsc.addDoc2Diff(__jsonpath2, __jsonpath1, "CompareProperties")
 				hasDiff = true
 			}
-		} else {
-			jsc.addDoc2Diff("-" + pathDoc1 + `["` + key + `"]`,"", "CompareProperties")
-			jsc.addDoc1Diff("+" + pathDoc1 + `["` + key + `"]`, pathDoc2, "CompareProperties")
+		} else if jsc.filter.state(key, item, nil, jsc.keyPath(pathDoc1, key), "").isCompared() {
+			jsc.addDoc2Diff("-" + jsc.keyPath(pathDoc1, key),"", "CompareProperties")
+			jsc.addDoc1Diff("+" + jsc.keyPath(pathDoc1, key), pathDoc2, "CompareProperties")
 			hasDiff = true
 		}
 
@@ -198,11 +273,11 @@ func (jsc * JsonStructureCompare) CompareProperties(doc1TreeMap map[string]inter
 
 	hasDiff = false
 	//collect only properties not doc1
-	for key, _:= range doc2TreeMap {
+	for key, item := range doc2TreeMap {
 
-		if _, ok := doc1TreeMap[key]; !ok {
-			jsc.addDoc1Diff("-" + pathDoc2 + `["` + key + `"]`,"","CompareProperties")
-			jsc.addDoc2Diff("+" + pathDoc2 + `["` + key + `"]`, pathDoc1, "CompareProperties")
+		if _, ok := doc1TreeMap[key]; !ok && jsc.filter.state(key, nil, item, "", jsc.keyPath(pathDoc2, key)).isCompared() {
+			jsc.addDoc1Diff("-" + jsc.keyPath(pathDoc2, key),"","CompareProperties")
+			jsc.addDoc2Diff("+" + jsc.keyPath(pathDoc2, key), pathDoc1, "CompareProperties")
 			hasDiff = true
 		}
 	}
@@ -220,6 +295,11 @@ func (jsc * JsonStructureCompare) CompareProperties(doc1TreeMap map[string]inter
 
 //Compare array sequence of json node for objectKeyName
 func CompareSequence(objectKeyName string, doc1TreeArray []interface{}, doc2TreeArray []interface{}) (map[int]int, map[int]int) {
+	return CompareSequenceBy(KeyIdentity(objectKeyName), doc1TreeArray, doc2TreeArray)
+}
+
+//Compare array sequence of json node for identity of elements
+func CompareSequenceBy(identity IdentityFunc, doc1TreeArray []interface{}, doc2TreeArray []interface{}) (map[int]int, map[int]int) {
 	//defer timeTrack(time.Now(), "CompareSequence" + path)
 	doc1Changes := make(map[int]int, len(doc1TreeArray))
 	doc2Changes := make(map[int]int, len(doc2TreeArray))
@@ -229,20 +309,16 @@ func CompareSequence(objectKeyName string, doc1TreeArray []interface{}, doc2Tree
 
 	//put doc1 indeces to map by given key
 	for index, item := range doc1TreeArray {
-		if itemTreeMap, isItemMap := item.(map[string]interface{}); isItemMap {
-			if objectId, ok := itemTreeMap[objectKeyName]; ok {
-				keysDoc1[objectId.(string)] = index
-			}
+		if objectId, ok := identity(item); ok {
+			keysDoc1[objectId] = index
 		}
 
 	}
 
 	//put doc2 indeces to map by given key
 	for index, item := range doc2TreeArray {
-		if itemTreeMap, isItemMap := item.(map[string]interface{}); isItemMap {
-			if objectId, ok := itemTreeMap[objectKeyName]; ok {
-				keysDoc2[objectId.(string)] = index
-			}
+		if objectId, ok := identity(item); ok {
+			keysDoc2[objectId] = index
 		}
 
 	}
@@ -274,6 +350,17 @@ func CompareSequence(objectKeyName string, doc1TreeArray []interface{}, doc2Tree
 }
 
 
+//Checks whether difference adds node of doc1, such differences are keyed by path prefixed with +
+func isAddDiff(key string) bool {
+	return key != "" && key[0] == '+'
+}
+
+//Checks whether difference deletes node of doc2, such differences are keyed by path prefixed with -
+//Deleted nodes have empty value, unlike added nodes at the root of JSON Pointer document which parent is empty too
+func isDeleteDiff(key string) bool {
+	return key != "" && key[0] == '-'
+}
+
 func (jsc * JsonStructureCompare) addDoc1Diff(jsonpathDoc1 string, jsonpathDoc2 interface{}, from string) {
 	//log.Printf("doc1Diff: %v %v %v\n", from, jsonpathDoc1, jsonpathDoc2)
 	jsc.Doc1Diffs[jsonpathDoc1] = jsonpathDoc2
@@ -312,27 +399,46 @@ func (jsc * JsonStructureCompare) removeDoc2ObjectRelocated(objectKeyValue strin
 	delete(jsc.Doc2ObjRelocate, objectKeyValue)
 }
 
+//Builds path of array element, by its object key if ObjectIDPaths option is set
+func (jsc * JsonStructureCompare) elementPath(path string, treeArray []interface{}, index int) string {
+	if jsc.Options.ObjectIDPaths && jsc.Options.PathFormat != JSONPointerFormat && index >= 0 && index < len(treeArray) {
+		if itemTreeMap, isItemMap := treeArray[index].(map[string]interface{}); isItemMap {
+			if objectId, ok := itemTreeMap[jsc.ObjectKeyName].(string); ok {
+				return ObjectIDPath(path, jsc.ObjectKeyName, objectId)
+			}
+		}
+	}
+
+	return jsc.indexPath(path, index)
+}
+
 //Compare each element in array node
 func (jsc * JsonStructureCompare) CompareSlices(doc1TreeArray []interface{}, doc2TreeArray []interface{}, pathDoc1 string, pathDoc2 string) (string, string, bool) {
 	//defer timeTrack(time.Now(), "CompareSlices " + path)
-	doc1Changes, doc2Changes := CompareSequence(jsc.ObjectKeyName, doc1TreeArray, doc2TreeArray)
+	doc1Changes, doc2Changes := CompareSequenceBy(jsc.arrayIdentity(pathDoc1, pathDoc2), doc1TreeArray, doc2TreeArray)
+
+	jsc.classes = append(jsc.classes, "")
+	defer func() { jsc.classes = jsc.classes[:len(jsc.classes) - 1] }()
 
 	doc1ChangesCopy := deepcopy.Copy(doc1Changes).(map[int]int)
 	doc2ChangesCopy := deepcopy.Copy(doc2Changes).(map[int]int)
 
 	//go thru array associations with the same objectKeyName for doc1
 	for idxDoc1, idxDoc2 := range doc1Changes {
-		jsonpathDoc1 := strings.Join([]string{pathDoc1, "[", strconv.Itoa(idxDoc1), "]"}, "")
-		jsonpathDoc2 := strings.Join([]string{pathDoc2, "[", strconv.Itoa(idxDoc2), "]"}, "")
+		jsonpathDoc1 := jsc.elementPath(pathDoc1, doc1TreeArray, idxDoc1)
+		jsonpathDoc2 := jsc.elementPath(pathDoc2, doc2TreeArray, idxDoc2)
 		if idxDoc1 == idxDoc2 {
 			//remove similar indeces
 			delete(doc1ChangesCopy, idxDoc1)
 		}
 		if idxDoc2 == -1 {
 			//if there is no such element in doc2 array
-			jsc.addDoc2Diff("-" + jsonpathDoc1, "","CompareSlices")
-			jsc.addDoc1Diff("+" + jsonpathDoc1, pathDoc2, "CompareSlices")
-		} else if __jsonpath1, __jsonpath2, ok := jsc.CompareDocuments(&(doc1TreeArray[idxDoc1]), &(doc2TreeArray[idxDoc2]), jsonpathDoc1, jsonpathDoc2); !ok {
+			if jsc.filter.state("", doc1TreeArray[idxDoc1], nil, jsonpathDoc1, "").isCompared() {
+				jsc.addDoc2Diff("-" + jsonpathDoc1, "","CompareSlices")
+				jsc.addDoc1Diff("+" + jsonpathDoc1, pathDoc2, "CompareSlices")
+			}
+		} else if __jsonpath1, __jsonpath2, ok := jsc.compareChild(jsc.filter.state("", doc1TreeArray[idxDoc1], doc2TreeArray[idxDoc2], jsonpathDoc1, jsonpathDoc2),
+			&(doc1TreeArray[idxDoc1]), &(doc2TreeArray[idxDoc2]), jsonpathDoc1, jsonpathDoc2); !ok {
 			jsc.addDoc1Diff(__jsonpath1, __jsonpath2, "CompareSlices")
 			jsc.addDoc2Diff(__jsonpath2, __jsonpath1, "CompareSlices")
 		}
@@ -344,9 +450,9 @@ func (jsc * JsonStructureCompare) CompareSlices(doc1TreeArray []interface{}, doc
 			//remove similar indeces
 			delete(doc2ChangesCopy, idxDoc2)
 		}
-		jsonpathDoc2 := strings.Join([]string{pathDoc2, "[", strconv.Itoa(idxDoc2), "]"}, "")
+		jsonpathDoc2 := jsc.elementPath(pathDoc2, doc2TreeArray, idxDoc2)
 
-		if idxDoc1 == -1 {
+		if idxDoc1 == -1 && jsc.filter.state("", nil, doc2TreeArray[idxDoc2], "", jsonpathDoc2).isCompared() {
 			//if there is no such element in doc1 array
 			jsc.addDoc1Diff("-" + jsonpathDoc2, "", "CompareSlices")
 			jsc.addDoc2Diff("+" + jsonpathDoc2, pathDoc1, "CompareSlices")
@@ -354,20 +460,24 @@ func (jsc * JsonStructureCompare) CompareSlices(doc1TreeArray []interface{}, doc
 	}
 
 	if len(doc1Changes) == 0 && len(doc2Changes) == 0 {
-		if !reflect.DeepEqual(doc1TreeArray, doc2TreeArray) {
-			jsc.addDoc1Diff(pathDoc1, pathDoc2, "CompareSlices")
-			jsc.addDoc2Diff(pathDoc2, pathDoc1, "CompareSlices")
+		if jsc.Options.LCSMatching && len(doc1TreeArray) * len(doc2TreeArray) <= maxLCSCells {
+			jsc.compareSimilar(doc1TreeArray, doc2TreeArray, pathDoc1, pathDoc2)
+		} else if !jsc.equalValues(doc1TreeArray, doc2TreeArray, pathDoc1) {
+			diffCount := len(jsc.Doc1Diffs)
 
 			for idxDoc1 := range doc1TreeArray {
-				jsonpathDoc1 := strings.Join([]string{pathDoc1, "[", strconv.Itoa(idxDoc1), "]"}, "")
-				jsonpathDoc2 := strings.Join([]string{pathDoc2, "[", strconv.Itoa(idxDoc1), "]"}, "")
+				jsonpathDoc1 := jsc.indexPath(pathDoc1, idxDoc1)
+				jsonpathDoc2 := jsc.indexPath(pathDoc2, idxDoc1)
 				if idxDoc1 >= len(doc2TreeArray) {
-					jsc.addDoc2Diff("-" + jsonpathDoc1, "","CompareSlices")
-					jsc.addDoc1Diff("+" + jsonpathDoc1, pathDoc2, "CompareSlices")
+					if jsc.filter.state("", doc1TreeArray[idxDoc1], nil, jsonpathDoc1, "").isCompared() {
+						jsc.addDoc2Diff("-" + jsonpathDoc1, "","CompareSlices")
+						jsc.addDoc1Diff("+" + jsonpathDoc1, pathDoc2, "CompareSlices")
+					}
 					continue
 				}
 
-				if __jsonpath1, __jsonpath2, ok := jsc.CompareDocuments(&(doc1TreeArray[idxDoc1]), &(doc2TreeArray[idxDoc1]), jsonpathDoc1, jsonpathDoc2); !ok {
+				if __jsonpath1, __jsonpath2, ok := jsc.compareChild(jsc.filter.state("", doc1TreeArray[idxDoc1], doc2TreeArray[idxDoc1], jsonpathDoc1, jsonpathDoc2),
+					&(doc1TreeArray[idxDoc1]), &(doc2TreeArray[idxDoc1]), jsonpathDoc1, jsonpathDoc2); !ok {
 					jsc.addDoc1Diff(__jsonpath1, __jsonpath2, "CompareSlices")
 					jsc.addDoc2Diff(__jsonpath2, __jsonpath1, "CompareSlices")
 				}
@@ -378,14 +488,20 @@ func (jsc * JsonStructureCompare) CompareSlices(doc1TreeArray []interface{}, doc
 				idxEnd := len(doc2TreeArray)
 
 				for idxDoc2 := idxStart; idxDoc2 < idxEnd; idxDoc2++ {
-					jsonpathDoc2 := strings.Join([]string{pathDoc2, "[", strconv.Itoa(idxDoc2), "]"}, "")
-					if idxDoc2 >= len(doc1TreeArray) {
+					jsonpathDoc2 := jsc.indexPath(pathDoc2, idxDoc2)
+					if idxDoc2 >= len(doc1TreeArray) && jsc.filter.state("", nil, doc2TreeArray[idxDoc2], "", jsonpathDoc2).isCompared() {
 						jsc.addDoc1Diff("-"+jsonpathDoc2, "", "CompareSlices")
 						jsc.addDoc2Diff("+"+jsonpathDoc2, pathDoc1, "CompareSlices")
 						continue
 					}
 				}
 			}
+
+			//with include and exclude rules array is changed only if its compared elements are
+			if jsc.filter == nil || len(jsc.Doc1Diffs) > diffCount {
+				jsc.addDoc1Diff(pathDoc1, pathDoc2, "CompareSlices")
+				jsc.addDoc2Diff(pathDoc2, pathDoc1, "CompareSlices")
+			}
 		}
 	}
 
@@ -401,6 +517,10 @@ func (jsc * JsonStructureCompare) CompareSlices(doc1TreeArray []interface{}, doc
 
 func (jsc * JsonStructureCompare) CompareDocuments(doc1 *interface{}, doc2 *interface{}, pathDoc1 string, pathDoc2 string) (string, string, bool) {
 	//defer timeTrack(time.Now(), "CompareDocuments " + path)
+	if jsc.isSameSubtree(*doc1, *doc2, pathDoc1, pathDoc2) {
+		return pathDoc1, pathDoc2, true
+	}
+
 	//try to convert to json type doc1
 
 	doc1TreeMap, isDoc1Map := (*doc1).(map[string]interface{})
@@ -419,7 +539,7 @@ func (jsc * JsonStructureCompare) CompareDocuments(doc1 *interface{}, doc2 *inte
 	} else if !isDoc1Array && !isDoc1Map && !isDoc2Array && !isDoc2Map {
 		//if values are not maps or arrays compare them by default
 
-		if *doc1 != *doc2 {
+		if *doc1 != *doc2 && !jsc.withinTolerance(*doc1, *doc2, pathDoc1) {
 			return pathDoc1 /*+ "+"*/, pathDoc2 /*+ "+"*/ /*+ fmt.Sprintf("%s", (*doc1), (*doc2))*/, false
 		}
 	} else {
@@ -432,19 +552,42 @@ func (jsc * JsonStructureCompare) CompareDocuments(doc1 *interface{}, doc2 *inte
 
 func (jsc * JsonStructureCompare) Compare(doc1TreeMap map[string]interface{}, doc2TreeMap map[string]interface{}, path string) {
 	defer timeTrack(time.Now(), "Compare" + path)
+	path = jsc.rootPath(path)
+	jsc.filter = jsc.newCompareFilter(doc1TreeMap, doc2TreeMap, path)
+	jsc.identities = jsc.Options.arrayIdentities()
+	jsc.identityPaths = jsc.identityArrayPaths(doc1TreeMap, doc2TreeMap, path)
+
+	//equal subtrees are skipped by their fingerprints, fingerprints are dropped once documents are compared
+	jsc.fingerprints = make(map[containerKey]fingerprint)
+	addFingerprints(doc1TreeMap, jsc.fingerprints)
+	addFingerprints(doc2TreeMap, jsc.fingerprints)
+
 	jsc.CompareProperties(doc1TreeMap, doc2TreeMap, path, path)
+	jsc.fingerprints = nil
+
+	if jsc.Options.DetectMoves {
+		jsc.detectMoves(doc1TreeMap, doc2TreeMap)
+	}
+
+	if jsc.Options.WithValues {
+		jsc.addDiffValues(doc1TreeMap, doc2TreeMap)
+	}
 }
 
 func NewJsonStructureCompare() *JsonStructureCompare {
-	return &JsonStructureCompare{make(map[string]interface{}),
-				     make(map[string]interface{}),
-					make(map[string]interface{}),
-					make(map[string]interface{}),
-						make(map[string]interface{}),
-						make(map[string]interface{}),
-						"do_objectID",
-							&DependentObjects{make(map[string]interface{}), make(map[string]interface{})},
-							&DependentObjects{make(map[string]interface{}), make(map[string]interface{})}}
+	return &JsonStructureCompare{
+		Doc1Diffs: make(map[string]interface{}),
+		Doc2Diffs: make(map[string]interface{}),
+		Doc1SeqDiffs: make(map[string]interface{}),
+		Doc2SeqDiffs: make(map[string]interface{}),
+		Doc1ObjRelocate: make(map[string]interface{}),
+		Doc2ObjRelocate: make(map[string]interface{}),
+		ObjectKeyName: "do_objectID",
+		DepDoc1: &DependentObjects{make(map[string]interface{}), make(map[string]interface{})},
+		DepDoc2: &DependentObjects{make(map[string]interface{}), make(map[string]interface{})},
+		Doc1MoveDiffs: make(map[string]interface{}),
+		Doc2MoveDiffs: make(map[string]interface{}),
+	}
 }
 
 func Test(doc1File string, doc2File string) (map[string]interface{}, map[string]interface{}) {
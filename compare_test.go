@@ -223,3 +223,41 @@ func TestJsonStructureCompare_Compare(t *testing.T) {
 
 	fmt.Println(string(compareInfo))
 }
+
+func TestJsonStructureCompare_ObjectIDPaths(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1"},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "renamed"}
+		], "points": [1, 2]}`), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2"},
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"}
+		], "points": [1, 3]}`), &jsonDoc2)
+
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.ObjectIDPaths = true
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	expected := map[string]interface{}{
+		`$["layers"][?do_objectID=="FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["name"]`: `$["layers"][?do_objectID=="FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["name"]`,
+		`+$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]`: `$["layers"]`,
+		`-$["layers"][?do_objectID=="1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]`: "",
+		`$["points"]`: `$["points"]`,
+		`$["points"][1]`: `$["points"][1]`,
+	}
+
+	for key, item := range expected {
+		if jsCompare.Doc1Diffs[key] != item {
+			t.Errorf("Expected diff %v -> %v, got %v", key, item, jsCompare.Doc1Diffs[key])
+		}
+	}
+
+	if len(jsCompare.Doc1Diffs) != len(expected) {
+		t.Errorf("Unexpected diffs %v", jsCompare.Doc1Diffs)
+	}
+}
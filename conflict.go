@@ -0,0 +1,174 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+//Type of conflicting changes
+type ConflictType uint8
+
+//Conflicting changes of ours and theirs documents
+const (
+	//both sides changed the same node
+	BothChanged = iota
+	//ours deleted the node theirs changed
+	OursDeleted
+	//theirs deleted the node ours changed
+	TheirsDeleted
+	//both sides reordered the same array
+	BothReordered
+)
+
+//Conflict of ours and theirs changes made since base document
+type Conflict struct {
+	FileKey string `json:"file_key"`
+	//jsonpath of conflicting node in base document
+	JsonPath string `json:"path"`
+	OursPath string `json:"ours_path,omitempty"`
+	TheirsPath string `json:"theirs_path,omitempty"`
+	OursValue interface{} `json:"ours_value"`
+	TheirsValue interface{} `json:"theirs_value"`
+	Type ConflictType `json:"type"`
+	//strategy applied to the conflict
+	Resolution ResolutionStrategy `json:"resolution"`
+	SketchLayerInfo
+}
+
+//Conflict report written next to merge output
+type MergeConflicts struct {
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+//Gets value of the node touched by change in document of one side
+func changeValue(doc map[string]interface{}, change baseChange) interface{} {
+	if change.kind == baseDeleteChange {
+		return nil
+	}
+
+	sel, _, err := Parse(change.sidePath)
+	if err != nil {
+		return nil
+	}
+
+	value, _, err := sel.Apply(doc)
+	if err != nil {
+		return nil
+	}
+
+	if change.kind == baseSequenceChange {
+		return identityKeys(arrayIdentity(DefaultIdentities(), "do_objectID", doc, change.sidePath), value)
+	}
+	return value
+}
+
+//Gets identities of array elements in their order, elements without identity are skipped
+func identityKeys(identity IdentityFunc, arr interface{}) []interface{} {
+	items, _ := arr.([]interface{})
+	keys := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if id, ok := identity(item); ok {
+			keys = append(keys, id)
+		}
+	}
+	return keys
+}
+
+//Gets object keys of array elements in their order
+func objectKeys(objectKeyName string, arr interface{}) []interface{} {
+	items, _ := arr.([]interface{})
+	keys := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if itemMap, isMap := item.(map[string]interface{}); isMap {
+			keys = append(keys, itemMap[objectKeyName])
+		}
+	}
+	return keys
+}
+
+//Checks whether keys present in both sequences follow in the same order
+func sameRelativeOrder(keys1 []interface{}, keys2 []interface{}) bool {
+	present := make(map[interface{}]bool, len(keys2))
+	for _, key := range keys2 {
+		present[key] = true
+	}
+
+	common := make([]interface{}, 0, len(keys1))
+	for _, key := range keys1 {
+		if present[key] {
+			common = append(common, key)
+		}
+		present[key] = false
+	}
+
+	index := 0
+	for _, key := range keys2 {
+		if index < len(common) && key == common[index] {
+			index++
+		}
+	}
+	return index == len(common)
+}
+
+//Builds conflict of overlapping ours and theirs changes
+//Changes having the same outcome are not conflicting
+func (md3 *MergeDocuments3) newConflict(oursChange baseChange, theirsChange baseChange) (Conflict, bool) {
+	if oursChange.kind == baseDeleteChange && theirsChange.kind == baseDeleteChange {
+		return Conflict{}, false
+	}
+
+	oursValue := changeValue(md3.OursDocument, oursChange)
+	theirsValue := changeValue(md3.TheirsDocument, theirsChange)
+
+	if oursChange.kind == theirsChange.kind && oursChange.path == theirsChange.path && reflect.DeepEqual(oursValue, theirsValue) {
+		return Conflict{}, false
+	}
+
+	if oursChange.kind == baseSequenceChange && theirsChange.kind == baseSequenceChange {
+		oursKeys, _ := oursValue.([]interface{})
+		theirsKeys, _ := theirsValue.([]interface{})
+		if sameRelativeOrder(oursKeys, theirsKeys) {
+			return Conflict{}, false
+		}
+	}
+
+	conflict := Conflict{JsonPath: theirsChange.path,
+		OursPath: oursChange.sidePath,
+		TheirsPath: theirsChange.sidePath,
+		OursValue: oursValue,
+		TheirsValue: theirsValue,
+		Type: BothChanged}
+
+	if isPathPrefix(oursChange.path, theirsChange.path) {
+		conflict.JsonPath = oursChange.path
+	}
+
+	switch {
+	case oursChange.kind == baseDeleteChange:
+		conflict.Type = OursDeleted
+	case theirsChange.kind == baseDeleteChange:
+		conflict.Type = TheirsDeleted
+	case oursChange.kind == baseSequenceChange && theirsChange.kind == baseSequenceChange:
+		conflict.Type = BothReordered
+	}
+
+	if sel, _, err := Parse(conflict.JsonPath); err == nil {
+		conflict.SketchLayerInfo, _, _, _ = getLayerInfo(md3.BaseDocument, sel)
+	}
+
+	return conflict, true
+}
+
+//Writes conflicts report in json format
+func WriteConflicts(path string, conflicts []Conflict) error {
+	if conflicts == nil {
+		conflicts = make([]Conflict, 0)
+	}
+
+	data, err := json.MarshalIndent(MergeConflicts{conflicts}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteToFile(path, data)
+}
@@ -0,0 +1,186 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Object moved between json files of sketch file, e.g. artboard moved to another page
+type FileMove struct {
+	ObjectKeyName string `json:"object_key"`
+	ObjectID string `json:"object_id"`
+	//file and path of the object in src
+	SrcFile string `json:"src_file"`
+	SrcPath string `json:"src_path"`
+	//file and path of the object in dst
+	DstFile string `json:"dst_file"`
+	DstPath string `json:"dst_path"`
+}
+
+//Object added to or deleted from json file
+type fileObject struct {
+	//index of merge action of the file
+	index int
+	path string
+}
+
+//Correlates objects added to one json file and deleted from another one by their object key
+//Such pairs of differences are replaced by file moves
+func (fs*FileStructureMerge) DetectFileMoves(workingDirV1 string, workingDirV2 string) error {
+	adds := make(map[string]fileObject)
+	deletes := make(map[string]fileObject)
+
+	for i := range fs.MergeActions {
+		fileMerge := &fs.MergeActions[i]
+		if fileMerge.Action != MERGE || strings.ToLower(fileMerge.FileExt) != ".json" {
+			continue
+		}
+
+		var srcDoc, dstDoc map[string]interface{}
+		for key := range fileMerge.FileDiff.Doc1Diffs {
+			var err error
+			switch {
+			case isDeleteDiff(key):
+				if dstDoc == nil {
+					if dstDoc, err = readJSON(workingDirV2 + string(os.PathSeparator) + fileMerge.FileKey + fileMerge.FileExt); err != nil {
+						return err
+					}
+				}
+				if id, ok := fileMerge.FileDiff.movedObjectID(dstDoc, key); ok {
+					deletes[id] = fileObject{i, key[1:]}
+				}
+			case isAddDiff(key):
+				if srcDoc == nil {
+					if srcDoc, err = readJSON(workingDirV1 + string(os.PathSeparator) + fileMerge.FileKey + fileMerge.FileExt); err != nil {
+						return err
+					}
+				}
+				if id, ok := fileMerge.FileDiff.movedObjectID(srcDoc, key); ok {
+					adds[id] = fileObject{i, key[1:]}
+				}
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(adds))
+	for id := range adds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		src := adds[id]
+		dst, ok := deletes[id]
+		if !ok || src.index == dst.index {
+			continue
+		}
+
+		srcMerge := &fs.MergeActions[src.index]
+		dstMerge := &fs.MergeActions[dst.index]
+
+		srcMerge.FileDiff.removeDiff("+" + src.path, "-" + src.path)
+		dstMerge.FileDiff.removeDiff("-" + dst.path, "+" + dst.path)
+
+		fs.FileMoves = append(fs.FileMoves, FileMove{
+			ObjectKeyName: srcMerge.FileDiff.ObjectKeyName,
+			ObjectID: id,
+			SrcFile: srcMerge.FileKey + srcMerge.FileExt,
+			SrcPath: src.path,
+			DstFile: dstMerge.FileKey + dstMerge.FileExt,
+			DstPath: dst.path,
+		})
+	}
+	return nil
+}
+
+//Removes src to dst difference and its dst to src counterpart
+func (jsc * JsonStructureCompare) removeDiff(doc1Key string, doc2Key string) {
+	delete(jsc.Doc1Diffs, doc1Key)
+	delete(jsc.Doc2Diffs, doc2Key)
+	delete(jsc.DiffValues, doc1Key)
+}
+
+//Replays moves of objects between json files of dst dir
+func replayFileMoves(workingDirV1 string, workingDirV2 string, moves []FileMove, tx *fileTransaction, report *MergeReport, isDryRun bool) {
+	for _, move := range moves {
+		step := StepResult{Action: ValueMove, SrcPath: move.SrcPath, DstPath: move.DstFile + ":" + move.DstPath, Status: ActionApplied}
+
+		targetDoc, holderDoc, err := replayFileMove(workingDirV1, workingDirV2, move, tx)
+		if err != nil {
+			step.Status = ActionFailed
+			step.Reason = err.Error()
+		}
+
+		ext := filepath.Ext(move.SrcFile)
+		report.addSteps(strings.TrimSuffix(move.SrcFile, ext), ext, []StepResult{step}, targetDoc, isDryRun && targetDoc != nil)
+
+		if holderDoc != nil {
+			ext = filepath.Ext(move.DstFile)
+			report.addSteps(strings.TrimSuffix(move.DstFile, ext), ext, nil, holderDoc, isDryRun)
+		}
+	}
+}
+
+//Moves object from dst file holding it to the dst file it has to be in and stages both files
+func replayFileMove(workingDirV1 string, workingDirV2 string, move FileMove, tx *fileTransaction) (map[string]interface{}, map[string]interface{}, error) {
+	srcDoc, err := readJSON(workingDirV1 + string(os.PathSeparator) + move.SrcFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetFilePath := workingDirV2 + string(os.PathSeparator) + move.SrcFile
+	holderFilePath := workingDirV2 + string(os.PathSeparator) + move.DstFile
+
+	targetDoc, err := readStagedJSON(targetFilePath, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	holderDoc, err := readStagedJSON(holderFilePath, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	objectKeyName := move.ObjectKeyName
+	if objectKeyName == "" {
+		objectKeyName = "do_objectID"
+	}
+
+	target := MergeDocuments{srcDoc, targetDoc}
+	srcSel, srcMap, err := target.movedSrcObject(objectKeyName, move.SrcPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := target.targetContainer(objectKeyName, srcSel.Parent()).Resolve(target.DstDocument); err != nil {
+		return nil, nil, err
+	}
+
+	holder := MergeDocuments{nil, holderDoc}
+	object, err := holder.takeObject(objectKeyName, move.ObjectID, move.DstPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := target.placeObject(objectKeyName, srcSel, srcMap, object); err != nil {
+		return nil, nil, err
+	}
+
+	targetData, err := json.Marshal(target.DstDocument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	holderData, err := json.Marshal(holder.DstDocument)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx.Stage(targetFilePath, targetData)
+	tx.Stage(holderFilePath, holderData)
+
+	return target.DstDocument, holder.DstDocument, nil
+}
@@ -0,0 +1,97 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessFileDiff_FileMoves(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	//artboard L is on page A in src and on page B in dst
+	writeTestFiles(t, srcDir, map[string]string{
+		"pages/A.json": `{"do_objectID": "A", "layers": [
+			{"_class": "artboard", "do_objectID": "A1"},
+			{"_class": "artboard", "do_objectID": "L", "name": "Moved"}]}`,
+		"pages/B.json": `{"do_objectID": "B", "layers": [{"_class": "artboard", "do_objectID": "B1"}]}`,
+	})
+	writeTestFiles(t, dstDir, map[string]string{
+		"pages/A.json": `{"do_objectID": "A", "layers": [{"_class": "artboard", "do_objectID": "A1"}]}`,
+		"pages/B.json": `{"do_objectID": "B", "layers": [
+			{"_class": "artboard", "do_objectID": "L", "name": "Old"},
+			{"_class": "artboard", "do_objectID": "B1"}]}`,
+	})
+
+	data, err := ProcessFileDiff(srcDir, dstDir, false, CompareOptions{DetectMoves: true})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	var fsMerge FileStructureMerge
+	if err := json.Unmarshal(data, &fsMerge); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	expected := FileMove{"do_objectID", "L", "pages/A.json", `$["layers"][1]`, "pages/B.json", `$["layers"][0]`}
+	if len(fsMerge.FileMoves) != 1 || fsMerge.FileMoves[0] != expected {
+		t.Fatalf("Expected file move %v, got %v", expected, fsMerge.FileMoves)
+	}
+
+	for _, fm := range fsMerge.MergeActions {
+		if _, ok := fm.FileDiff.Doc1Diffs[`+$["layers"][1]`]; ok && fm.FileKey == "pages/A" {
+			t.Errorf("Expected add of moved artboard removed from diff %v", fm.FileDiff.Doc1Diffs)
+		}
+		if _, ok := fm.FileDiff.Doc1Diffs[`-$["layers"][0]`]; ok && fm.FileKey == "pages/B" {
+			t.Errorf("Expected delete of moved artboard removed from diff %v", fm.FileDiff.Doc1Diffs)
+		}
+	}
+
+	mergeFile := filepath.Join(srcDir, "merge.json")
+	if err := ioutil.WriteFile(mergeFile, data, 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if report.HasFailures() {
+		t.Fatalf("Unexpected failures %v", report.Failures())
+	}
+
+	pageA, err := readJSON(filepath.Join(dstDir, "pages", "A.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	pageB, err := readJSON(filepath.Join(dstDir, "pages", "B.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	if ids := objectKeys("do_objectID", pageA["layers"]); len(ids) != 2 || ids[1] != "L" {
+		t.Errorf("Expected artboard moved to page A, got %v", ids)
+	}
+	if ids := objectKeys("do_objectID", pageB["layers"]); len(ids) != 1 || ids[0] != "B1" {
+		t.Errorf("Expected artboard removed from page B, got %v", ids)
+	}
+
+	layers, _ := pageA["layers"].([]interface{})
+	if moved, _ := layers[len(layers) - 1].(map[string]interface{}); moved["name"] != "Moved" {
+		t.Errorf("Expected changes of moved artboard merged, got %v", moved)
+	}
+}
@@ -0,0 +1,244 @@
+package sketchmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	documentFileKey = "document"
+	metaFileKey = "meta"
+	pagesFileKey = "pages/"
+)
+
+//Applies file level action of merge entry
+//Actions describe changes of src set into dst set, so merge reverts them:
+//files deleted from src set are copied from src dir, files added to dst set are removed from dst dir
+func mergeFileAction(workingDirV1 string, workingDirV2 string, fileMerge FileMerge, tx *fileTransaction) MergeResult {
+	result := MergeResult{FileKey: fileMerge.FileKey, FileExt: fileMerge.FileExt, Status: ActionApplied}
+	srcFilePath := workingDirV1 + string(os.PathSeparator) + fileMerge.FileKey + fileMerge.FileExt
+	dstFilePath := workingDirV2 + string(os.PathSeparator) + fileMerge.FileKey + fileMerge.FileExt
+
+	switch fileMerge.Action {
+	case DELETE:
+		if fileMerge.IsDirectory {
+			result.Status = ActionSkipped
+			result.Reason = "directory is created with its files"
+			return result
+		}
+
+		data, err := ioutil.ReadFile(srcFilePath)
+		if err != nil {
+			result.Status = ActionFailed
+			result.Reason = err.Error()
+			return result
+		}
+		tx.Stage(dstFilePath, data)
+	case ADD:
+		if _, err := os.Stat(dstFilePath); os.IsNotExist(err) {
+			result.Status = ActionSkipped
+			result.Reason = "already deleted"
+			return result
+		}
+		tx.Remove(dstFilePath)
+	}
+	return result
+}
+
+//Decodes staged or written json file of dst dir
+func readStagedJSON(path string, tx *fileTransaction) (map[string]interface{}, error) {
+	data, ok := tx.Staged(path)
+	if !ok {
+		return readJSON(path)
+	}
+
+	var result map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//Gets ids of pages of dst dir after commit of the transaction
+func mergedPageIDs(workingDirV2 string, tx *fileTransaction) []string {
+	pagesDir := workingDirV2 + string(os.PathSeparator) + strings.TrimSuffix(pagesFileKey, "/")
+	paths, _ := filepath.Glob(pagesDir + string(os.PathSeparator) + "*.json")
+	paths = append(paths, tx.paths...)
+
+	ids := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if filepath.Dir(path) != pagesDir || strings.ToLower(filepath.Ext(path)) != ".json" || !tx.Exists(path) {
+			continue
+		}
+		id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+//Rebuilds page indexes of dst dir from the merged page set:
+//pages references of document.json and pagesAndArtboards of meta.json
+func reconcilePages(workingDirV1 string, workingDirV2 string, tx *fileTransaction, report *MergeReport, isDryRun bool) error {
+	pageIDs := mergedPageIDs(workingDirV2, tx)
+
+	if err := reconcilePageRefs(workingDirV1, workingDirV2, pageIDs, tx, report, isDryRun); err != nil {
+		return err
+	}
+	return reconcilePagesAndArtboards(workingDirV2, pageIDs, tx, report, isDryRun)
+}
+
+//Keeps pages references of document.json consistent with the merged page set
+//References of missing pages are removed, pages without reference get one in order of src document.json
+func reconcilePageRefs(workingDirV1 string, workingDirV2 string, pageIDs []string, tx *fileTransaction, report *MergeReport, isDryRun bool) error {
+	docFilePath := workingDirV2 + string(os.PathSeparator) + documentFileKey + ".json"
+	if !tx.Exists(docFilePath) {
+		return nil
+	}
+
+	doc, err := readStagedJSON(docFilePath, tx)
+	if err != nil {
+		return err
+	}
+
+	isPage := make(map[string]bool, len(pageIDs))
+	for _, id := range pageIDs {
+		isPage[pagesFileKey + id] = true
+	}
+
+	pages, _ := doc["pages"].([]interface{})
+	refs := make([]interface{}, 0, len(pageIDs))
+	steps := make([]StepResult, 0)
+
+	for _, ref := range pages {
+		key := refKey(ref)
+		if isPage[key] && indexOfObject("_ref", key, refs) == -1 {
+			refs = append(refs, ref)
+		} else {
+			steps = append(steps, StepResult{Action: ValueDelete, DstPath: ObjectIDPath(`-$["pages"]`, "_ref", key), Status: ActionApplied})
+		}
+	}
+
+	//references are copied from src document.json when possible
+	missing := make([]interface{}, 0)
+	if srcDoc, err := readJSON(workingDirV1 + string(os.PathSeparator) + documentFileKey + ".json"); err == nil {
+		srcPages, _ := srcDoc["pages"].([]interface{})
+		for _, ref := range srcPages {
+			if key := refKey(ref); isPage[key] && indexOfObject("_ref", key, refs) == -1 && indexOfObject("_ref", key, missing) == -1 {
+				missing = append(missing, ref)
+			}
+		}
+	}
+	for _, id := range pageIDs {
+		if key := pagesFileKey + id; indexOfObject("_ref", key, refs) == -1 && indexOfObject("_ref", key, missing) == -1 {
+			missing = append(missing, map[string]interface{}{"_class": "MSJSONFileReference", "_ref_class": "MSImmutablePage", "_ref": key})
+		}
+	}
+
+	for _, ref := range missing {
+		refs = append(refs, ref)
+		steps = append(steps, StepResult{Action: ValueAdd, SrcPath: ObjectIDPath(`+$["pages"]`, "_ref", refKey(ref)), DstPath: `$["pages"]`, Status: ActionApplied})
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+
+	doc["pages"] = refs
+	return stageReconciled(docFilePath, documentFileKey, doc, steps, tx, report, isDryRun)
+}
+
+//Gets _ref of file reference
+func refKey(ref interface{}) string {
+	refMap, _ := ref.(map[string]interface{})
+	key, _ := refMap["_ref"].(string)
+	return key
+}
+
+//Rebuilds pagesAndArtboards of meta.json from names of merged pages and their artboards
+func reconcilePagesAndArtboards(workingDirV2 string, pageIDs []string, tx *fileTransaction, report *MergeReport, isDryRun bool) error {
+	metaFilePath := workingDirV2 + string(os.PathSeparator) + metaFileKey + ".json"
+	if !tx.Exists(metaFilePath) {
+		return nil
+	}
+
+	meta, err := readStagedJSON(metaFilePath, tx)
+	if err != nil {
+		return err
+	}
+
+	oldIndex, _ := meta["pagesAndArtboards"].(map[string]interface{})
+	index := make(map[string]interface{}, len(pageIDs))
+	steps := make([]StepResult, 0)
+
+	for _, id := range pageIDs {
+		page, err := readStagedJSON(workingDirV2 + string(os.PathSeparator) + pagesFileKey + id + ".json", tx)
+		if err != nil {
+			return err
+		}
+
+		entry := pageEntry(page)
+		index[id] = entry
+
+		path := `$["pagesAndArtboards"]` + KeySegment(id)
+		if old, ok := oldIndex[id]; !ok {
+			steps = append(steps, StepResult{Action: ValueAdd, DstPath: path, Status: ActionApplied})
+		} else if !reflect.DeepEqual(old, entry) {
+			steps = append(steps, StepResult{Action: ValueChange, DstPath: path, Status: ActionApplied})
+		}
+	}
+
+	for _, id := range sortedKeys(oldIndex) {
+		if _, ok := index[id]; !ok {
+			steps = append(steps, StepResult{Action: ValueDelete, DstPath: `-$["pagesAndArtboards"]` + KeySegment(id), Status: ActionApplied})
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+
+	meta["pagesAndArtboards"] = index
+	return stageReconciled(metaFilePath, metaFileKey, meta, steps, tx, report, isDryRun)
+}
+
+//Builds pagesAndArtboards entry of page: its name and names of its artboards and symbol masters
+func pageEntry(page map[string]interface{}) map[string]interface{} {
+	artboards := make(map[string]interface{})
+	layers, _ := page["layers"].([]interface{})
+	for _, layer := range layers {
+		layerMap, ok := layer.(map[string]interface{})
+		if !ok || (layerMap["_class"] != "artboard" && layerMap["_class"] != "symbolMaster") {
+			continue
+		}
+		if id, ok := layerMap["do_objectID"].(string); ok {
+			artboards[id] = map[string]interface{}{"name": layerMap["name"]}
+		}
+	}
+	return map[string]interface{}{"name": page["name"], "artboards": artboards}
+}
+
+//Stages reconciled json file and adds reconciliation steps to report of the file
+func stageReconciled(path string, fileKey string, doc map[string]interface{}, steps []StepResult, tx *fileTransaction, report *MergeReport, isDryRun bool) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	tx.Stage(path, data)
+
+	report.addSteps(fileKey, ".json", steps, doc, isDryRun)
+	return nil
+}
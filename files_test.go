@@ -0,0 +1,189 @@
+package sketchmerge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+	}
+}
+
+func TestProcessFileMerge_FileActions(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	writeTestFiles(t, srcDir, map[string]string{
+		"document.json": `{"pages": [{"_class": "MSJSONFileReference", "_ref_class": "MSImmutablePage", "_ref": "pages/A"}]}`,
+		"pages/A.json": `{"do_objectID": "A", "layers": []}`,
+		"pages/B.json": `{"do_objectID": "B", "name": "Page B", "layers": [
+			{"_class": "artboard", "do_objectID": "B1", "name": "Artboard"},
+			{"_class": "rectangle", "do_objectID": "B2", "name": "Rectangle"}]}`,
+		"images/x.png": "png",
+	})
+	writeTestFiles(t, dstDir, map[string]string{
+		"document.json": `{"pages": [
+			{"_class": "MSJSONFileReference", "_ref_class": "MSImmutablePage", "_ref": "pages/A"},
+			{"_class": "MSJSONFileReference", "_ref_class": "MSImmutablePage", "_ref": "pages/C"}]}`,
+		"pages/A.json": `{"do_objectID": "A", "layers": []}`,
+		"pages/C.json": `{"do_objectID": "C", "layers": []}`,
+		"meta.json": `{"appVersion": "48", "pagesAndArtboards": {
+			"A": {"name": null, "artboards": {}},
+			"C": {"name": "Page C", "artboards": {}}}}`,
+	})
+
+	//document.json of src doesn't reference new page B, so the merge has to add the reference
+	mergeInfo := `{"merge_actions": [
+		{"file_key": "document", "file_ext": ".json", "file_copy_action": 0},
+		{"file_key": "pages/A", "file_ext": ".json", "file_copy_action": 0},
+		{"file_key": "pages/B", "file_ext": ".json", "file_copy_action": 1},
+		{"file_key": "images/x", "file_ext": ".png", "file_copy_action": 1},
+		{"file_key": "pages/C.json", "file_ext": "", "file_copy_action": 2}]}`
+	mergeFile := filepath.Join(srcDir, "merge.json")
+	if err := ioutil.WriteFile(mergeFile, []byte(mergeInfo), 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if report.HasFailures() {
+		t.Fatalf("Unexpected failures %v", report.Failures())
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(dstDir, "images", "x.png")); err != nil || string(data) != "png" {
+		t.Errorf("Expected copied image, got %s %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "pages", "B.json")); err != nil {
+		t.Errorf("Expected copied page, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "pages", "C.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected removed page, got %v", err)
+	}
+
+	doc, err := readJSON(filepath.Join(dstDir, "document.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	if refs := objectKeys("_ref", doc["pages"]); !reflect.DeepEqual(refs, []interface{}{"pages/A", "pages/B"}) {
+		t.Errorf("Expected references of existing pages, got %v", refs)
+	}
+
+	meta, err := readJSON(filepath.Join(dstDir, "meta.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"A": map[string]interface{}{"name": nil, "artboards": map[string]interface{}{}},
+		"B": map[string]interface{}{"name": "Page B", "artboards": map[string]interface{}{
+			"B1": map[string]interface{}{"name": "Artboard"},
+		}},
+	}
+	if !reflect.DeepEqual(meta["pagesAndArtboards"], expected) || meta["appVersion"] != "48" {
+		t.Errorf("Expected pages and artboards of merged pages, got %v", meta)
+	}
+}
+
+func TestFileStructureMerge_FileSetChange(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	writeTestFiles(t, srcDir, map[string]string{"document.json": "{}", "pages/B.json": "{}"})
+	writeTestFiles(t, dstDir, map[string]string{"document.json": "{}", "pages/C.json": "{}"})
+
+	fsMerge := new(FileStructureMerge)
+	fsMerge.FileSetChange(ExtractSketchDirStruct(srcDir, dstDir))
+
+	actions := make(map[string]FileActionType)
+	for _, fm := range fsMerge.MergeActions {
+		actions[fm.FileKey + fm.FileExt] = fm.Action
+	}
+
+	//files only in base set are deleted and files only in new set are added, as in merge files of earlier versions
+	expected := map[string]FileActionType{"document.json": MERGE, "pages": MERGE, "pages/B.json": DELETE, "pages/C.json": ADD}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("Expected actions %v, got %v", expected, actions)
+	}
+
+	for _, fm := range fsMerge.MergeActions {
+		if fm.Action == ADD && !reflect.DeepEqual(fm, FileMerge{FileKey: "pages/C.json", Action: ADD}) {
+			t.Errorf("Expected added file entry in format of earlier versions, got %v", fm)
+		}
+	}
+}
+
+func TestProcessFileMerge_FileSetChange(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	writeTestFiles(t, srcDir, map[string]string{"document.json": `{"name": "src"}`, "pages/B.json": `{"do_objectID": "B"}`})
+	writeTestFiles(t, dstDir, map[string]string{"document.json": `{"name": "dst"}`, "pages/C.json": `{"do_objectID": "C"}`})
+
+	mergeInfo, err := ProcessFileDiff(srcDir, dstDir, false, CompareOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	mergeFile := srcDir + ".merge.json"
+	if err := ioutil.WriteFile(mergeFile, mergeInfo, 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.Remove(mergeFile)
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{})
+	if err != nil || report.HasFailures() {
+		t.Fatalf("Merge failed: %v %v", err, report)
+	}
+
+	if _, err := os.Stat(filepath.Join(dstDir, "pages", "B.json")); err != nil {
+		t.Errorf("Expected page of src only, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "pages", "C.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected page of dst only removed, got %v", err)
+	}
+	if doc, err := readJSON(filepath.Join(dstDir, "document.json")); err != nil || doc["name"] != "src" {
+		t.Errorf("Expected merged document, got %v %v", doc, err)
+	}
+}
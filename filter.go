@@ -0,0 +1,442 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Selects array elements matching filter expression, e.g. [?(@._class=="text" && @.name=~/^Title/)]
+type FilterSelection struct {
+	Expression string
+	filter filterExpr
+	RootNode
+}
+
+func (f *FilterSelection) Apply(v interface{}) (interface{}, Node, error) {
+	return f.ApplyWithEvent(v, nil)
+}
+
+func (f *FilterSelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
+	matches, err := selectChildren(f, v)
+	if err != nil {
+		return v, f, err
+	}
+	return applyMatches(f, matches, e)
+}
+
+//Gets nil, indices of matches are given by nodes passed to events
+func (f *FilterSelection) GetKey() interface{} {
+	return nil
+}
+
+//Gets children of array or map matching the filter
+func (f *FilterSelection) selectMatches(v interface{}) ([]nodeMatch, error) {
+	matches := make([]nodeMatch, 0)
+	switch value := v.(type) {
+	case []interface{}:
+		for index, child := range value {
+			if f.filter.eval(child) {
+				matches = append(matches, nodeMatch{index, child})
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			if f.filter.eval(value[key]) {
+				matches = append(matches, nodeMatch{key, value[key]})
+			}
+		}
+	default:
+		return nil, ArrayTypeError
+	}
+	return matches, nil
+}
+
+//Gets index of closing bracket of jsonpath segment starting at s[0]
+//Filter expressions may contain brackets, so they end with )]
+//Quoted keys and values may contain escaped quotes and brackets
+func bracketEnd(s string) int {
+	switch {
+	case strings.HasPrefix(s, "[?("):
+		for i := 3; i < len(s) - 1; i++ {
+			switch s[i] {
+			case '"', '\'':
+				end := quoteEnd(s[i:])
+				if end == -1 {
+					return -1
+				}
+				i += end
+			case ')':
+				if s[i+1] == ']' {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	case strings.HasPrefix(s, `["`):
+		return quotedBracketEnd(s, 1)
+	case strings.HasPrefix(s, "[?"):
+		eq := strings.Index(s, `=="`)
+		if eq == -1 {
+			return -1
+		}
+		return quotedBracketEnd(s, eq + 2)
+	}
+	return strings.Index(s, "]")
+}
+
+//Gets index of bracket closing segment with quoted string starting at s[quote]
+func quotedBracketEnd(s string, quote int) int {
+	end := quoteEnd(s[quote:])
+	if end == -1 || quote + end + 1 >= len(s) || s[quote + end + 1] != ']' {
+		return -1
+	}
+	return quote + end + 1
+}
+
+//Parses filter segment [?(expression)]
+func getFilterNode(s string) (Node, error) {
+	expression := s[3 : len(s)-2]
+
+	parser := &filterParser{input: expression}
+	filter, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipSpaces()
+	if parser.pos != len(parser.input) {
+		return nil, SyntaxError
+	}
+
+	return &FilterSelection{Expression: expression, filter: filter}, nil
+}
+
+//Filter expression evaluated against array element
+type filterExpr interface {
+	eval(v interface{}) bool
+}
+
+type filterOr struct {
+	left, right filterExpr
+}
+
+func (f *filterOr) eval(v interface{}) bool {
+	return f.left.eval(v) || f.right.eval(v)
+}
+
+type filterAnd struct {
+	left, right filterExpr
+}
+
+func (f *filterAnd) eval(v interface{}) bool {
+	return f.left.eval(v) && f.right.eval(v)
+}
+
+type filterNot struct {
+	expr filterExpr
+}
+
+func (f *filterNot) eval(v interface{}) bool {
+	return !f.expr.eval(v)
+}
+
+//Comparison of element property with literal, property existence check if op is empty
+type filterCompare struct {
+	keys []string
+	op string
+	value interface{}
+	reg *regexp.Regexp
+}
+
+func (f *filterCompare) eval(v interface{}) bool {
+	for _, key := range f.keys {
+		vMap, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = vMap[key]; !ok {
+			return false
+		}
+	}
+
+	switch f.op {
+	case "":
+		return true
+	case "=~":
+		str, ok := v.(string)
+		return ok && f.reg.MatchString(str)
+	case "==":
+		return filterEqual(v, f.value)
+	case "!=":
+		return !filterEqual(v, f.value)
+	}
+
+	if str1, ok := v.(string); ok {
+		str2, ok := f.value.(string)
+		return ok && compareOrder(f.op, strings.Compare(str1, str2))
+	}
+
+	num1, ok1 := toFloat(v)
+	num2, ok2 := toFloat(f.value)
+	if !ok1 || !ok2 {
+		return false
+	}
+
+	switch {
+	case num1 < num2:
+		return compareOrder(f.op, -1)
+	case num1 > num2:
+		return compareOrder(f.op, 1)
+	}
+	return compareOrder(f.op, 0)
+}
+
+func compareOrder(op string, order int) bool {
+	switch op {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
+
+func filterEqual(v1 interface{}, v2 interface{}) bool {
+	num1, ok1 := toFloat(v1)
+	num2, ok2 := toFloat(v2)
+	if ok1 && ok2 {
+		return num1 == num2
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+//Converts json number to float64
+func toFloat(v interface{}) (float64, bool) {
+	switch num := v.(type) {
+	case float64:
+		return num, true
+	case int:
+		return float64(num), true
+	case json.Number:
+		f, err := num.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//Recursive descent parser of filter expressions
+type filterParser struct {
+	input string
+	pos int
+}
+
+func (p *filterParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *filterParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	if p.consume("!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{expr}, nil
+	}
+
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, SyntaxError
+		}
+		return expr, nil
+	}
+
+	return p.parseCompare()
+}
+
+func (p *filterParser) parseCompare() (filterExpr, error) {
+	if !p.consume("@") {
+		return nil, SyntaxError
+	}
+
+	compare := &filterCompare{keys: make([]string, 0)}
+	for p.pos < len(p.input) {
+		if p.input[p.pos] == '.' {
+			start := p.pos + 1
+			p.pos = start
+			for p.pos < len(p.input) && isIdentChar(p.input[p.pos]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, SyntaxError
+			}
+			compare.keys = append(compare.keys, p.input[start:p.pos])
+		} else if strings.HasPrefix(p.input[p.pos:], `["`) {
+			end := quoteEnd(p.input[p.pos+1:])
+			if end == -1 || p.pos + end + 2 >= len(p.input) || p.input[p.pos+end+2] != ']' {
+				return nil, SyntaxError
+			}
+			compare.keys = append(compare.keys, unescapeKey(p.input[p.pos+2:p.pos+1+end]))
+			p.pos += end + 3
+		} else {
+			break
+		}
+	}
+
+	for _, op := range []string{"==", "!=", "=~", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			compare.op = op
+			break
+		}
+	}
+
+	if compare.op == "" {
+		return compare, nil
+	}
+
+	if compare.op == "=~" {
+		reg, err := p.parseRegexp()
+		if err != nil {
+			return nil, err
+		}
+		compare.reg = reg
+		return compare, nil
+	}
+
+	value, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	compare.value = value
+	return compare, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+//Parses /pattern/ with optional i flag
+func (p *filterParser) parseRegexp() (*regexp.Regexp, error) {
+	if !p.consume("/") {
+		return nil, SyntaxError
+	}
+
+	end := p.pos
+	for end < len(p.input) && p.input[end] != '/' {
+		if p.input[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.input) {
+		return nil, SyntaxError
+	}
+
+	pattern := p.input[p.pos:end]
+	p.pos = end + 1
+	if p.pos < len(p.input) && p.input[p.pos] == 'i' {
+		pattern = "(?i)" + pattern
+		p.pos++
+	}
+
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, SyntaxError
+	}
+	return reg, nil
+}
+
+//Parses string, number, true, false or null literal
+func (p *filterParser) parseLiteral() (interface{}, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, SyntaxError
+	}
+
+	if quote := p.input[p.pos]; quote == '"' || quote == '\'' {
+		end := quoteEnd(p.input[p.pos:])
+		if end == -1 {
+			return nil, SyntaxError
+		}
+		value := unescapeKey(p.input[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+		return value, nil
+	}
+
+	for _, literal := range []string{"true", "false", "null"} {
+		if p.consume(literal) {
+			switch literal {
+			case "true":
+				return true, nil
+			case "false":
+				return false, nil
+			}
+			return nil, nil
+		}
+	}
+
+	end := p.pos
+	for end < len(p.input) && strings.IndexByte("+-.0123456789eE", p.input[end]) != -1 {
+		end++
+	}
+
+	value, err := strconv.ParseFloat(p.input[p.pos:end], 64)
+	if err != nil {
+		return nil, SyntaxError
+	}
+	p.pos = end
+	return value, nil
+}
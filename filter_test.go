@@ -0,0 +1,92 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFilterSelection(t *testing.T) {
+	var doc map[string]interface{}
+	err := json.Unmarshal([]byte(`{"layers":[
+			{"_class": "text", "name": "Title 1", "frame": {"x": 10}},
+			{"_class": "text", "name": "Body", "frame": {"x": 20}},
+			{"_class": "group", "name": "Title group", "frame": {"x": 30}},
+			{"_class": "text", "name": "Title [2]", "frame": {"x": 40}, "isLocked": true}
+		]}`), &doc)
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	tests := map[string][]string{
+		`$["layers"][?(@._class=="text" && @.name=~/^Title/)]`: {`$["layers"][0]`, `$["layers"][3]`},
+		`$["layers"][?(@._class!="text" || @.frame.x>=40)]["name"]`: {`$["layers"][2]["name"]`, `$["layers"][3]["name"]`},
+		`$["layers"][?(@.isLocked)]`: {`$["layers"][3]`},
+		`$["layers"][?(!(@.name=~/title/i))]`: {`$["layers"][1]`},
+		`$["layers"][?(@["name"]=='Title [2]')]`: {`$["layers"][3]`},
+		`$["layers"][?(@.frame.x<20)]`: {`$["layers"][0]`},
+	}
+
+	for path, expected := range tests {
+		paths, err := ExpandJSONPath(doc, path)
+		if err != nil {
+			t.Errorf("Expand %v failed: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expand %v: expected %v, got %v", path, expected, paths)
+		}
+	}
+
+	sel, _, err := Parse(`$["layers"][?(@._class=="group")]["name"]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if value, _, err := sel.Apply(doc); err != nil || value != "Title group" {
+		t.Errorf("Expected Title group, got %v %v", value, err)
+	}
+
+	//filter node is not changed by matches, so parsed path may be shared
+	sel, _, _ = Parse(`$["layers"][?(@._class=="text")]`)
+	indices := make([]interface{}, 0)
+	sel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
+		indices = append(indices, node.GetKey())
+		return true
+	})
+	if !reflect.DeepEqual(indices, []interface{}{nil, "layers", 0, 1, 3}) || sel.GetNext().GetNext().GetKey() != nil {
+		t.Errorf("Unexpected keys of matches %v", indices)
+	}
+
+	if _, _, err := Parse(`$["layers"][?(@._class=="group" &&)]`); err != SyntaxError {
+		t.Errorf("Expected syntax error, got %v", err)
+	}
+}
+
+func TestMergeDocuments_MergeByFilter(t *testing.T) {
+	var src, dst map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers":[
+			{"_class": "text", "name": "Title 1"},
+			{"_class": "group", "name": "Group"}
+		]}`), &src)
+	err2 := json.Unmarshal([]byte(`{"layers":[
+			{"_class": "text", "name": "Title 2"},
+			{"_class": "text", "name": "Title 3"},
+			{"_class": "group", "name": "Group"}
+		]}`), &dst)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	mergeDoc := MergeDocuments{src, dst}
+	if err := mergeDoc.MergeByJSONPath("", `-$["layers"][?(@._class=="text")]`); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath(`+$["layers"][?(@._class=="text")]`, `$["layers"]`); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	layers := dst["layers"].([]interface{})
+	if len(layers) != 2 || layers[1].(map[string]interface{})["name"] != "Title 1" {
+		t.Errorf("Unexpected layers %v", layers)
+	}
+}
@@ -0,0 +1,131 @@
+package sketchmerge
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math"
+	"reflect"
+)
+
+//Merkle fingerprint of json subtree, equal subtrees have equal fingerprints
+//Collision resistant hash is used, as different subtrees with equal fingerprints would hide their differences
+type fingerprint [sha256.Size]byte
+
+//Decoded map or array identified by its address
+type containerKey struct {
+	pointer uintptr
+	length int
+	isArray bool
+}
+
+//Gets key of map or array, false for other values
+func containerKeyOf(v interface{}) (containerKey, bool) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return containerKey{reflect.ValueOf(value).Pointer(), len(value), false}, true
+	case []interface{}:
+		return containerKey{reflect.ValueOf(value).Pointer(), len(value), true}, true
+	}
+	return containerKey{}, false
+}
+
+//Computes fingerprints of all maps and arrays of the document bottom-up, each one from fingerprints of its children
+func addFingerprints(v interface{}, fingerprints map[containerKey]fingerprint) fingerprint {
+	var result fingerprint
+
+	h := sha256.New()
+	switch value := v.(type) {
+	case map[string]interface{}:
+		h.Write([]byte{'{'})
+		for _, key := range sortedKeys(value) {
+			writeString(h, key)
+			writeValue(h, value[key], fingerprints)
+		}
+	case []interface{}:
+		h.Write([]byte{'['})
+		for _, item := range value {
+			writeValue(h, item, fingerprints)
+		}
+	default:
+		writeValue(h, v, fingerprints)
+		copy(result[:], h.Sum(nil))
+		return result
+	}
+
+	copy(result[:], h.Sum(nil))
+	if key, ok := containerKeyOf(v); ok {
+		fingerprints[key] = result
+	}
+	return result
+}
+
+//Writes fingerprint of child container or tagged scalar value
+func writeValue(h hash.Hash, v interface{}, fingerprints map[containerKey]fingerprint) {
+	var buf [8]byte
+	switch value := v.(type) {
+	case map[string]interface{}, []interface{}:
+		child := addFingerprints(value, fingerprints)
+		h.Write([]byte{'c'})
+		h.Write(child[:])
+	case string:
+		h.Write([]byte{'s'})
+		writeString(h, value)
+	case json.Number:
+		h.Write([]byte{'n'})
+		writeString(h, string(value))
+	case float64:
+		h.Write([]byte{'f'})
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(value))
+		h.Write(buf[:])
+	case bool:
+		if value {
+			h.Write([]byte{'t'})
+		} else {
+			h.Write([]byte{'b'})
+		}
+	case nil:
+		h.Write([]byte{'z'})
+	default:
+		h.Write([]byte{'v'})
+		writeString(h, fmt.Sprintf("%T:%v", value, value))
+	}
+}
+
+//Writes length prefixed string, so concatenated strings can't collide
+func writeString(h hash.Hash, s string) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(s)))
+	h.Write(buf[:])
+	h.Write([]byte(s))
+}
+
+//Gets fingerprints of containers compared at the same time, false if any of them has no fingerprint
+func (jsc * JsonStructureCompare) fingerprintsOf(doc1 interface{}, doc2 interface{}) (fingerprint, fingerprint, bool) {
+	if jsc.fingerprints == nil {
+		return fingerprint{}, fingerprint{}, false
+	}
+
+	key1, ok1 := containerKeyOf(doc1)
+	key2, ok2 := containerKeyOf(doc2)
+	if !ok1 || !ok2 {
+		return fingerprint{}, fingerprint{}, false
+	}
+
+	fingerprint1, ok1 := jsc.fingerprints[key1]
+	fingerprint2, ok2 := jsc.fingerprints[key2]
+	return fingerprint1, fingerprint2, ok1 && ok2
+}
+
+//Checks whether containers at the same path have equal fingerprints, so their comparison can't record anything
+//Equal subtrees at different paths are still compared to record relocations of their objects
+func (jsc * JsonStructureCompare) isSameSubtree(doc1 interface{}, doc2 interface{}, pathDoc1 string, pathDoc2 string) bool {
+	if pathDoc1 != pathDoc2 {
+		return false
+	}
+
+	fingerprint1, fingerprint2, ok := jsc.fingerprintsOf(doc1, doc2)
+	return ok && fingerprint1 == fingerprint2
+}
@@ -0,0 +1,106 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestAddFingerprints(t *testing.T) {
+	var doc1, doc2, doc3 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"a": {"x": 1, "y": [true, null, "s"]}, "b": "1"}`), &doc1)
+	err2 := json.Unmarshal([]byte(`{"b": "1", "a": {"y": [true, null, "s"], "x": 1}}`), &doc2)
+	err3 := json.Unmarshal([]byte(`{"a": {"x": 1, "y": [true, null, "s"]}, "b": 1}`), &doc3)
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+	}
+
+	fingerprints := make(map[containerKey]fingerprint)
+	fingerprint1 := addFingerprints(doc1, fingerprints)
+	fingerprint2 := addFingerprints(doc2, fingerprints)
+	fingerprint3 := addFingerprints(doc3, fingerprints)
+
+	if fingerprint1 != fingerprint2 {
+		t.Errorf("Expected equal fingerprints regardless of order of keys")
+	}
+	if fingerprint1 == fingerprint3 {
+		t.Errorf("Expected different fingerprints of string and number")
+	}
+
+	//root, two objects and array of each document
+	if len(fingerprints) != 9 {
+		t.Errorf("Expected fingerprints of all containers, got %v", len(fingerprints))
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.fingerprints = fingerprints
+	if !jsCompare.isSameSubtree(doc1["a"], doc3["a"], `$["a"]`, `$["a"]`) {
+		t.Errorf("Expected equal subtrees")
+	}
+	if jsCompare.isSameSubtree(doc1, doc3, "$", "$") || jsCompare.isSameSubtree(doc1["b"], doc2["b"], `$["b"]`, `$["b"]`) {
+		t.Errorf("Expected different documents and no fingerprints of scalars")
+	}
+	if jsCompare.isSameSubtree(doc1["a"], doc3["a"], `$["a"]`, `$["c"]`) {
+		t.Errorf("Expected equal subtrees at different paths to be compared")
+	}
+}
+
+func TestJsonStructureCompare_FingerprintsRelocations(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers": [{"do_objectID": "A", "layers": [{"do_objectID": "A1"}]}, {"do_objectID": "B"}]}`), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(`{"layers": [{"do_objectID": "X"}, {"do_objectID": "A", "layers": [{"do_objectID": "A1"}]}, {"do_objectID": "B"}]}`), &jsonDoc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	//equal objects shifted by added one are relocated
+	expected1 := map[string]interface{}{"A": `$["layers"][0]`, "A1": `$["layers"][0]["layers"][0]`, "B": `$["layers"][1]`}
+	expected2 := map[string]interface{}{"A": `$["layers"][1]`, "A1": `$["layers"][1]["layers"][0]`, "B": `$["layers"][2]`}
+	if !reflect.DeepEqual(jsCompare.Doc1ObjRelocate, expected1) || !reflect.DeepEqual(jsCompare.Doc2ObjRelocate, expected2) {
+		t.Errorf("Unexpected relocations %v %v", jsCompare.Doc1ObjRelocate, jsCompare.Doc2ObjRelocate)
+	}
+}
+
+func TestJsonStructureCompare_Fingerprints(t *testing.T) {
+	src := `{"layers": [
+		{"do_objectID": "A", "name": "Group", "layers": [{"do_objectID": "B", "frame": {"x": 1, "y": 2}}]},
+		{"do_objectID": "C", "name": "Text", "points": [1, 2, 3]}]}`
+	dst := `{"layers": [
+		{"do_objectID": "C", "name": "Label", "points": [1, 2, 3]},
+		{"do_objectID": "A", "name": "Group", "layers": [{"do_objectID": "B", "frame": {"x": 1, "y": 2}}]}]}`
+
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(src), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(dst), &jsonDoc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	if keys := sortedDiffKeys(jsCompare.Doc1Diffs); !reflect.DeepEqual(keys, []string{`$["layers"][1]["name"]`}) {
+		t.Errorf("Expected only change of reordered text, got %v", keys)
+	}
+	if keys := sortedDiffKeys(jsCompare.Doc1SeqDiffs); !reflect.DeepEqual(keys, []string{`$["layers"]`}) {
+		t.Errorf("Expected sequence change of layers, got %v", keys)
+	}
+	if jsCompare.fingerprints != nil {
+		t.Errorf("Expected fingerprints dropped after comparison")
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+	for i, err := range mergeDoc.ApplyPlan(PlanMerge(jsCompare)) {
+		if err != nil {
+			t.Errorf("Step %v failed: %v", i, err)
+		}
+	}
+
+	if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+		data, _ := json.Marshal(mergeDoc.DstDocument)
+		t.Errorf("Expected merged document equal to src, got %s", data)
+	}
+}
@@ -0,0 +1,170 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+//Gets identity matching array element with element of another array, false if element has no identity
+type IdentityFunc func(element interface{}) (string, bool)
+
+//Identity of elements of arrays selected by all of its non empty conditions
+type ArrayIdentity struct {
+	//jsonpath pattern of arrays, e.g. $..overrideValues
+	Path string
+	//_class of the object holding the array, e.g. symbolInstance
+	Class string
+	//property name of the array, e.g. overrideValues
+	Key string
+	Identity IdentityFunc
+}
+
+//Identities of arrays of sketch documents which elements have no object key
+func DefaultIdentities() []ArrayIdentity {
+	return []ArrayIdentity{
+		{Class: "symbolInstance", Key: "overrideValues", Identity: KeyIdentity("overrideName")},
+		{Class: "document", Key: "pages", Identity: KeyIdentity("_ref")},
+		{Class: "exportOptions", Key: "exportFormats", Identity: KeyIdentity("fileFormat", "name", "scale")},
+	}
+}
+
+//Builds identity of map elements by values of their properties
+//Single property has to be string, e.g. overrideName, several properties give composite identity
+func KeyIdentity(keys ...string) IdentityFunc {
+	return func(element interface{}) (string, bool) {
+		elementMap, isMap := element.(map[string]interface{})
+		if !isMap {
+			return "", false
+		}
+
+		if len(keys) == 1 {
+			id, ok := elementMap[keys[0]].(string)
+			return id, ok
+		}
+
+		values := make([]interface{}, len(keys))
+		hasValue := false
+		for i, key := range keys {
+			if value, ok := elementMap[key]; ok {
+				values[i] = value
+				hasValue = true
+			}
+		}
+
+		if !hasValue {
+			return "", false
+		}
+
+		data, err := json.Marshal(values)
+		return string(data), err == nil
+	}
+}
+
+//Gets identities registered by options followed by default ones
+func (opts CompareOptions) arrayIdentities() []ArrayIdentity {
+	identities := make([]ArrayIdentity, 0, len(opts.Identities) + 3)
+	identities = append(identities, opts.Identities...)
+	return append(identities, DefaultIdentities()...)
+}
+
+//Checks whether identity applies to array held by object of class, isKey and isPath tell whether property name and path of the array match
+func (identity *ArrayIdentity) applies(class string, isKey bool, isPath bool) bool {
+	if identity.Identity == nil || (identity.Class == "" && identity.Key == "" && identity.Path == "") {
+		return false
+	}
+
+	if identity.Class != "" && identity.Class != class {
+		return false
+	}
+
+	if identity.Key != "" && !isKey {
+		return false
+	}
+
+	if identity.Path != "" && !isPath {
+		return false
+	}
+
+	return true
+}
+
+//Gets paths of arrays of doc1 and doc2 selected by path patterns of identities
+func (jsc * JsonStructureCompare) identityArrayPaths(doc1 map[string]interface{}, doc2 map[string]interface{}, path string) [][2]map[string]bool {
+	paths := make([][2]map[string]bool, len(jsc.identities))
+	for i, identity := range jsc.identities {
+		if identity.Path != "" {
+			paths[i] = jsc.patternPaths(identity.Path, doc1, doc2, path)
+		}
+	}
+	return paths
+}
+
+//Gets identity of elements of compared arrays, elements are matched by object key if no identity applies to the arrays
+//Class of the object holding the arrays is on top of the classes stack
+func (jsc * JsonStructureCompare) arrayIdentity(pathDoc1 string, pathDoc2 string) IdentityFunc {
+	if jsc.identities == nil {
+		jsc.identities = jsc.Options.arrayIdentities()
+	}
+
+	class := ""
+	if len(jsc.classes) > 0 {
+		class = jsc.classes[len(jsc.classes) - 1]
+	}
+
+	for i := range jsc.identities {
+		identity := &jsc.identities[i]
+		isKey := identity.Key != "" && strings.HasSuffix(pathDoc1, jsc.keyPath("", identity.Key))
+		isPath := i < len(jsc.identityPaths) && (jsc.identityPaths[i][0][pathDoc1] || jsc.identityPaths[i][1][pathDoc2])
+		if identity.applies(class, isKey, isPath) {
+			return identity.Identity
+		}
+	}
+	return KeyIdentity(jsc.ObjectKeyName)
+}
+
+//Gets identity of elements of array at path of doc, elements are matched by object key if no identity applies to the array
+func arrayIdentity(identities []ArrayIdentity, objectKeyName string, doc map[string]interface{}, path string) IdentityFunc {
+	p, err := ParsePath(path)
+	if err != nil || p.IsRoot() {
+		return KeyIdentity(objectKeyName)
+	}
+	p = p.bindLast(doc)
+
+	parent, _ := p.Parent().Resolve(doc)
+	parentMap, _ := parent.(map[string]interface{})
+	class, _ := parentMap["_class"].(string)
+
+	key := ""
+	if sel, ok := p.Last().(*MapSelection); ok {
+		key = sel.Key
+	}
+
+	for i := range identities {
+		identity := &identities[i]
+		isPath := identity.Path != "" && selectsNode(doc, identity.Path, path)
+		if identity.applies(class, identity.Key != "" && identity.Key == key, isPath) {
+			return identity.Identity
+		}
+	}
+	return KeyIdentity(objectKeyName)
+}
+
+//Checks whether jsonpath pattern selects node at path of doc
+func selectsNode(doc map[string]interface{}, pattern string, path string) bool {
+	pointer, err := concretePointer(doc, path)
+	if err != nil {
+		return false
+	}
+
+	expanded, err := ExpandJSONPath(doc, pattern)
+	if err != nil {
+		return false
+	}
+
+	for _, concrete := range expanded {
+		if selected, err := concretePointer(doc, concrete); err == nil && selected == pointer {
+			return true
+		}
+	}
+	return false
+}
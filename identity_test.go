@@ -0,0 +1,84 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestJsonStructureCompare_ArrayIdentity(t *testing.T) {
+	src := `{"_class": "page", "layers": [{"_class": "symbolInstance", "do_objectID": "S",
+		"overrideValues": [
+			{"_class": "overrideValue", "overrideName": "B_stringValue", "value": "new"},
+			{"_class": "overrideValue", "overrideName": "A_stringValue", "value": "a"}],
+		"style": {"_class": "style", "fills": [{"fillType": 1, "opacity": 1}, {"fillType": 0, "opacity": 0.5}]}}]}`
+	dst := `{"_class": "page", "layers": [{"_class": "symbolInstance", "do_objectID": "S",
+		"overrideValues": [
+			{"_class": "overrideValue", "overrideName": "A_stringValue", "value": "a"},
+			{"_class": "overrideValue", "overrideName": "B_stringValue", "value": "old"}],
+		"style": {"_class": "style", "fills": [{"fillType": 0, "opacity": 1}, {"fillType": 1, "opacity": 1}]}}]}`
+
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(src), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(dst), &jsonDoc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	fillIdentity := func(element interface{}) (string, bool) {
+		fill, _ := element.(map[string]interface{})
+		fillType, ok := fill["fillType"].(float64)
+		return strconv.FormatFloat(fillType, 'f', -1, 64), ok
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.Identities = []ArrayIdentity{{Path: `$..fills`, Identity: fillIdentity}}
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	expected := []string{
+		`$["layers"][0]["overrideValues"][0]["value"]`,
+		`$["layers"][0]["style"]["fills"][1]["opacity"]`,
+	}
+	if keys := sortedDiffKeys(jsCompare.Doc1Diffs); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected differences of matched elements %v, got %v", expected, keys)
+	}
+
+	if item := jsCompare.Doc1Diffs[expected[0]]; item != `$["layers"][0]["overrideValues"][1]["value"]` {
+		t.Errorf("Expected override value matched by overrideName, got %v", item)
+	}
+
+	if keys := sortedDiffKeys(jsCompare.Doc1SeqDiffs); !reflect.DeepEqual(keys, []string{`$["layers"][0]["overrideValues"]`, `$["layers"][0]["style"]["fills"]`}) {
+		t.Errorf("Expected sequence differences of reordered arrays, got %v", keys)
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+	for i, err := range mergeDoc.ApplyPlan(PlanMerge(jsCompare)) {
+		if err != nil {
+			t.Errorf("Step %v failed: %v", i, err)
+		}
+	}
+
+	if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+		data, _ := json.Marshal(mergeDoc.DstDocument)
+		t.Errorf("Expected merged document equal to src, got %s", data)
+	}
+}
+
+func TestKeyIdentity(t *testing.T) {
+	identity := KeyIdentity("fileFormat", "name", "scale")
+
+	id1, ok1 := identity(map[string]interface{}{"fileFormat": "png", "name": "", "scale": 2.0})
+	id2, ok2 := identity(map[string]interface{}{"fileFormat": "png", "name": "", "scale": 1.0})
+	if !ok1 || !ok2 || id1 == id2 {
+		t.Errorf("Expected different composite identities, got %v %v", id1, id2)
+	}
+
+	if _, ok := identity(map[string]interface{}{"opacity": 1}); ok {
+		t.Errorf("Expected no identity without keys")
+	}
+
+	if id, ok := KeyIdentity("_ref")(map[string]interface{}{"_ref": "pages/A"}); !ok || id != "pages/A" {
+		t.Errorf("Expected _ref identity, got %v", id)
+	}
+}
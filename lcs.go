@@ -0,0 +1,86 @@
+package sketchmerge
+
+//Arrays with more pairs of elements than maxLCSCells are compared by index
+const maxLCSCells = 1 << 20
+
+//Gets pairs of indices of equal elements of doc1 and doc2 arrays forming their longest common subsequence
+func (jsc * JsonStructureCompare) commonSubsequence(doc1TreeArray []interface{}, doc2TreeArray []interface{}, pathDoc1 string) [][2]int {
+	n, m := len(doc1TreeArray), len(doc2TreeArray)
+
+	//lengths[i][j] is length of common subsequence of doc1 elements from i and doc2 elements from j
+	lengths := make([][]int, n + 1)
+	isEqual := make([][]bool, n)
+	for i := range lengths {
+		lengths[i] = make([]int, m + 1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		isEqual[i] = make([]bool, m)
+		for j := m - 1; j >= 0; j-- {
+			isEqual[i][j] = jsc.equalValues(doc1TreeArray[i], doc2TreeArray[j], jsc.indexPath(pathDoc1, i))
+			switch {
+			case isEqual[i][j]:
+				lengths[i][j] = lengths[i + 1][j + 1] + 1
+			case lengths[i + 1][j] >= lengths[i][j + 1]:
+				lengths[i][j] = lengths[i + 1][j]
+			default:
+				lengths[i][j] = lengths[i][j + 1]
+			}
+		}
+	}
+
+	matches := make([][2]int, 0, lengths[0][0])
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case isEqual[i][j]:
+			matches = append(matches, [2]int{i, j})
+			i++
+			j++
+		case lengths[i + 1][j] >= lengths[i][j + 1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+//Compares arrays without object keys by longest common subsequence of their elements
+//Elements between equal ones are compared pairwise, the rest of them are added or deleted
+//Unlike comparison by index, no change of the whole array is reported, so merge replays the entries one by one
+func (jsc * JsonStructureCompare) compareSimilar(doc1TreeArray []interface{}, doc2TreeArray []interface{}, pathDoc1 string, pathDoc2 string) {
+	matches := jsc.commonSubsequence(doc1TreeArray, doc2TreeArray, pathDoc1)
+	matches = append(matches, [2]int{len(doc1TreeArray), len(doc2TreeArray)})
+
+	idxDoc1, idxDoc2 := 0, 0
+	for _, match := range matches {
+		for ; idxDoc1 < match[0] && idxDoc2 < match[1]; idxDoc1, idxDoc2 = idxDoc1 + 1, idxDoc2 + 1 {
+			jsonpathDoc1 := jsc.indexPath(pathDoc1, idxDoc1)
+			jsonpathDoc2 := jsc.indexPath(pathDoc2, idxDoc2)
+			state := jsc.filter.state("", doc1TreeArray[idxDoc1], doc2TreeArray[idxDoc2], jsonpathDoc1, jsonpathDoc2)
+
+			if __jsonpath1, __jsonpath2, ok := jsc.compareChild(state, &(doc1TreeArray[idxDoc1]), &(doc2TreeArray[idxDoc2]), jsonpathDoc1, jsonpathDoc2); !ok {
+				jsc.addDoc1Diff(__jsonpath1, __jsonpath2, "compareSimilar")
+				jsc.addDoc2Diff(__jsonpath2, __jsonpath1, "compareSimilar")
+			}
+		}
+
+		for ; idxDoc1 < match[0]; idxDoc1++ {
+			jsonpathDoc1 := jsc.indexPath(pathDoc1, idxDoc1)
+			if jsc.filter.state("", doc1TreeArray[idxDoc1], nil, jsonpathDoc1, "").isCompared() {
+				jsc.addDoc2Diff("-" + jsonpathDoc1, "", "compareSimilar")
+				jsc.addDoc1Diff("+" + jsonpathDoc1, pathDoc2, "compareSimilar")
+			}
+		}
+
+		for ; idxDoc2 < match[1]; idxDoc2++ {
+			jsonpathDoc2 := jsc.indexPath(pathDoc2, idxDoc2)
+			if jsc.filter.state("", nil, doc2TreeArray[idxDoc2], "", jsonpathDoc2).isCompared() {
+				jsc.addDoc1Diff("-" + jsonpathDoc2, "", "compareSimilar")
+				jsc.addDoc2Diff("+" + jsonpathDoc2, pathDoc1, "compareSimilar")
+			}
+		}
+
+		idxDoc1, idxDoc2 = match[0] + 1, match[1] + 1
+	}
+}
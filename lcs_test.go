@@ -0,0 +1,142 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJsonStructureCompare_LCSMatching(t *testing.T) {
+	cases := []struct {
+		src string
+		dst string
+		expected []string
+	}{
+		//inserted curve point doesn't change the following ones
+		{`{"points": [{"x": 0}, {"x": 1}, {"x": 2}, {"x": 3}]}`, `{"points": [{"x": 0}, {"x": 2}, {"x": 3}]}`,
+			[]string{`+$["points"][1]`}},
+		{`{"points": [{"x": 0}, {"x": 2}, {"x": 3}]}`, `{"points": [{"x": 0}, {"x": 1}, {"x": 2}, {"x": 3}]}`,
+			[]string{`-$["points"][1]`}},
+		{`{"stops": [{"color": "red", "position": 0}, {"color": "blue", "position": 1}, {"color": "green", "position": 1}]}`,
+			`{"stops": [{"color": "white", "position": 0}, {"color": "red", "position": 0}, {"color": "black", "position": 1}]}`,
+			[]string{`$["stops"][1]["color"]`, `+$["stops"][2]`, `-$["stops"][0]`}},
+	}
+
+	for _, c := range cases {
+		var jsonDoc1, jsonDoc2 map[string]interface{}
+		err1 := json.Unmarshal([]byte(c.src), &jsonDoc1)
+		err2 := json.Unmarshal([]byte(c.dst), &jsonDoc2)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("Error occured %v %v", err1, err2)
+		}
+
+		jsCompare := NewJsonStructureCompare()
+		jsCompare.Options.LCSMatching = true
+		jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+		if keys := sortedDiffKeys(jsCompare.Doc1Diffs); !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("Expected differences %v, got %v", c.expected, keys)
+		}
+
+		mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+		for i, err := range mergeDoc.ApplyPlan(PlanMerge(jsCompare)) {
+			if err != nil {
+				t.Errorf("Step %v failed: %v", i, err)
+			}
+		}
+
+		if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+			data, _ := json.Marshal(mergeDoc.DstDocument)
+			t.Errorf("Expected merged document equal to src %v, got %s", c.src, data)
+		}
+	}
+}
+
+func TestMergeDocuments_AddSimilarElement(t *testing.T) {
+	decode := func(doc string) map[string]interface{} {
+		var result map[string]interface{}
+		if err := json.Unmarshal([]byte(doc), &result); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+		return result
+	}
+
+	src := decode(`{"points": [{"x": 0}, {"x": 1}, {"x": 2}], "items": [{"id": "a"}, {"id": "b"}, {"id": "c"}]}`)
+	dst := `{"points": [{"x": 0}, {"x": 2}], "items": [{"id": "c"}, {"id": "a"}]}`
+
+	//elements are appended unless differences come from longest common subsequence
+	mergeDoc := MergeDocuments{src, decode(dst)}
+	if err := mergeDoc.MergeByJSONPath(`+$["points"][1]`, `$["points"]`); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if points := mergeDoc.DstDocument["points"]; !reflect.DeepEqual(points, decode(`{"p": [{"x": 0}, {"x": 2}, {"x": 1}]}`)["p"]) {
+		t.Errorf("Expected appended point, got %v", points)
+	}
+
+	mergeDoc = MergeDocuments{src, decode(dst)}
+	if err := mergeDoc.addSimilarElement(nil, "id", `+$["points"][1]`, `$["points"]`); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if points := mergeDoc.DstDocument["points"]; !reflect.DeepEqual(points, src["points"]) {
+		t.Errorf("Expected point at its src index, got %v", points)
+	}
+
+	//elements having object key aren't placed by index
+	if err := mergeDoc.addSimilarElement(nil, "id", `+$["items"][1]`, `$["items"]`); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if items := objectKeys("id", mergeDoc.DstDocument["items"]); !reflect.DeepEqual(items, []interface{}{"c", "a", "b"}) {
+		t.Errorf("Expected appended item, got %v", items)
+	}
+}
+
+func TestProcessFileMerge_LCSMatching(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	writeTestFiles(t, srcDir, map[string]string{"document.json": `{"points": [{"x": 0}, {"x": 1}, {"x": 2}]}`})
+	writeTestFiles(t, dstDir, map[string]string{"document.json": `{"points": [{"x": 0}, {"x": 2}]}`})
+
+	mergeInfo, err := ProcessFileDiff(srcDir, dstDir, false, CompareOptions{LCSMatching: true})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+
+	var fsMerge FileStructureMerge
+	if err := json.Unmarshal(mergeInfo, &fsMerge); err != nil || !fsMerge.LCSMatching {
+		t.Fatalf("Expected matching mode in merge file, got %s %v", mergeInfo, err)
+	}
+
+	mergeFile := srcDir + ".merge.json"
+	if err := ioutil.WriteFile(mergeFile, mergeInfo, 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.Remove(mergeFile)
+
+	//merge follows matching mode of the merge file
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{})
+	if err != nil || report.HasFailures() {
+		t.Fatalf("Merge failed: %v %v", err, report)
+	}
+
+	doc, err := readJSON(filepath.Join(dstDir, "document.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	data, _ := json.Marshal(doc["points"])
+	if string(data) != `[{"x":0},{"x":1},{"x":2}]` {
+		t.Errorf("Expected point inserted at its src index, got %s", data)
+	}
+}
@@ -6,10 +6,9 @@ import (
 	_"fmt"
 	_ "encoding/json"
 	_ "reflect"
-	_ "sort"
+	"sort"
 	"strconv"
 	"strings"
-	"log"
 )
 
 type NodeEvent func(interface{}, Node, Node) bool
@@ -41,6 +40,7 @@ const (
 	ValueDelete
 	ValueAdd
 	SequenceChange
+	ValueMove
 )
 
 type ApplyAction uint8
@@ -147,6 +147,8 @@ func (m *MapSelection) GetKey() interface{} {
 
 type ArraySelection struct {
 	Key int
+	//JSON Pointer token the index was parsed from, selects map property when applied to map
+	Token string
 	RootNode
 }
 func (a *ArraySelection) Apply(v interface{}) (interface{}, Node, error) {
@@ -155,26 +157,102 @@ func (a *ArraySelection) Apply(v interface{}) (interface{}, Node, error) {
 
 func (a *ArraySelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
 	arv, ok := v.([]interface{})
+	if mv, isMap := v.(map[string]interface{}); isMap && a.Token != "" {
+		nv, ok := mv[a.Token]
+		if !ok {
+			return nil, a, NotFound
+		}
+		if e != nil && !e(nv, a.PrevNode, a) {
+			return nv, a, nil
+		}
+		return applyNext(a.NextNode, a, nv, e)
+	}
 	if !ok {
 		return v, a, ArrayTypeError
 	}
 	// Check to see if the value is in bounds for the array.
-	if a.Key < 0 || a.Key >= len(arv) {
-		return nil, a, IndexOutOfBounds
-
+	index, err := arrayIndex(a, arv)
+	if err != nil {
+		return nil, a, err
 	}
 
-	if e != nil && !e(arv[a.Key], a.PrevNode, a) {
-		return arv[a.Key], a, nil
+	if e != nil && !e(arv[index], a.PrevNode, a) {
+		return arv[index], a, nil
 	}
 
-	return applyNext(a.NextNode, a, arv[a.Key], e)
+	return applyNext(a.NextNode, a, arv[index], e)
 }
 
 func (a *ArraySelection) GetKey() interface{} {
 	return a.Key
 }
 
+//Selects array element by value of its object key, e.g. [?do_objectID=="..."]
+type ObjectIDSelection struct {
+	KeyName string
+	Value string
+	RootNode
+}
+
+func (o *ObjectIDSelection) Apply(v interface{}) (interface{}, Node, error) {
+	return o.ApplyWithEvent(v, nil)
+}
+
+func (o *ObjectIDSelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
+	arv, ok := v.([]interface{})
+	if !ok {
+		return v, o, ArrayTypeError
+	}
+
+	index := o.Index(arv)
+	if index == -1 {
+		return nil, o, NotFound
+	}
+
+	if e != nil && !e(arv[index], o.PrevNode, o) {
+		return arv[index], o, nil
+	}
+
+	return applyNext(o.NextNode, o, arv[index], e)
+}
+
+func (o *ObjectIDSelection) GetKey() interface{} {
+	return o.Value
+}
+
+//Gets index of selected element in array or -1 if there is no such element
+func (o *ObjectIDSelection) Index(arv []interface{}) int {
+	return indexOfObject(o.KeyName, o.Value, arv)
+}
+
+//Gets index of array element selected by node
+func arrayIndex(node Node, arv []interface{}) (int, error) {
+	switch sel := node.(type) {
+	case *ArraySelection:
+		//negative index is counted from the end of array
+		index := sel.Key
+		if index < 0 {
+			index += len(arv)
+		}
+		if index < 0 || index >= len(arv) {
+			return -1, IndexOutOfBounds
+		}
+		return index, nil
+	case *ObjectIDSelection:
+		index := sel.Index(arv)
+		if index == -1 {
+			return -1, NotFound
+		}
+		return index, nil
+	}
+	return -1, ArrayTypeError
+}
+
+//Builds jsonpath of array element selected by value of its object key
+func ObjectIDPath(path string, objectKeyName string, objectKeyValue string) string {
+	return path + `[?` + objectKeyName + `=="` + escapeKey(objectKeyValue) + `"]`
+}
+
 func minNotNeg1(a int, bs ...int) int {
 	m := a
 	for _, b := range bs {
@@ -207,9 +285,20 @@ func normalize(s string) string {
 
 	for len(s) > 0 {
 
+		// Keep recursive descent, dot before name is optional
+		if strings.HasPrefix(s, "..") {
+			r += ".."
+			s = s[2:]
+		} else if s[0] == '.' {
+			s = s[1:]
+		}
+
 		// Grab the bracketed entries
 		for len(s) > 0 && s[0] == '[' {
-			n := strings.Index(s, "]")
+			n := bracketEnd(s)
+			if n == -1 {
+				return r + s
+			}
 			r += s[0 : n+1]
 			s = s[n+1:]
 		}
@@ -217,15 +306,15 @@ func normalize(s string) string {
 			break
 		}
 
-		n := minNotNeg1(strings.Index(s, "["))
+		n := minNotNeg1(strings.Index(s, "["), strings.Index(s, "."))
 		if n == 0 {
 			continue
 		}
 		if n != -1 {
-			r += `["` + s[:n] + `"]`
+			r += KeySegment(s[:n])
 			s = s[n:]
 		} else {
-			r += `["` + s + `"]`
+			r += KeySegment(s)
 			s = ""
 		}
 
@@ -238,7 +327,10 @@ func getNode(s string) (Node, string, error) {
 	if len(s) == 0 {
 		return nil, s, io.EOF
 	}
-	n := strings.Index(s, "]")
+	if strings.HasPrefix(s, "..") {
+		return getRecursiveNode(s[2:])
+	}
+	n := bracketEnd(s)
 	if n == -1 {
 		return nil, s, SyntaxError
 	}
@@ -246,10 +338,29 @@ func getNode(s string) (Node, string, error) {
 		rs = s[n+1:]
 	}
 	switch s[:2] {
+	case "[*":
+		if n != 2 {
+			return nil, rs, SyntaxError
+		}
+		return &WildcardSelection{}, rs, nil
 	case "[\"":
 		//fmt.Printf("parse map %v\n", s[2 : n-1])
-		return &MapSelection{Key: s[2 : n-1]}, rs, nil
-	default: // Assume it's a array index otherwise.
+		return &MapSelection{Key: unescapeKey(s[2 : n-1])}, rs, nil
+	case "[?":
+		if strings.HasPrefix(s, "[?(") {
+			nn, err := getFilterNode(s[:n+1])
+			return nn, rs, err
+		}
+		eq := strings.Index(s, "==\"")
+		if eq == -1 || eq > n || s[n-1] != '"' {
+			return nil, rs, SyntaxError
+		}
+		return &ObjectIDSelection{KeyName: s[2:eq], Value: unescapeKey(s[eq+3 : n-1])}, rs, nil
+	default: // Assume it's a array index or slice otherwise.
+		if strings.Contains(s[1:n], ":") {
+			nn, err := getSliceNode(s[1:n])
+			return nn, rs, err
+		}
 		i, err := strconv.Atoi(s[1:n])
 		if err != nil {
 			return nil, rs, SyntaxError
@@ -265,7 +376,10 @@ func Parse(s string) (Node, ApplyAction, error) {
 	var nn Node
 	var err error
 	var action ApplyAction = ValueChange
-	s = normalize(s)
+	pointer := isPointer(s)
+	if !pointer {
+		s = normalize(s)
+	}
 	rt := RootNode{nil, nil, nil}
 
 	if s[0] == '-' {
@@ -276,9 +390,20 @@ func Parse(s string) (Node, ApplyAction, error) {
 		action = ValueAdd
 	}
 
-	s = s[1:]
 	var c Node
 	c = &rt
+
+	if pointer {
+		for _, nn := range parsePointer(s) {
+			c.SetNext(nn)
+			nn.SetPrev(c)
+			c = nn
+		}
+		rt.SetLast(c)
+		return &rt, action, nil
+	}
+
+	s = s[1:]
 	for len(s) > 0 {
 		nn, s, err = getNode(s)
 		if err != nil {
@@ -293,187 +418,267 @@ func Parse(s string) (Node, ApplyAction, error) {
 	return &rt, action, nil
 }
 
-func (md * MergeDocuments) setArrayElement(srcNode Node, dstNode Node) error {
+func (md * MergeDocuments) setArrayElement(srcPath Path, dstPath Path) error {
+	src, err := srcPath.Resolve(md.SrcDocument)
+	if err != nil {
+		return err
+	}
 
+	if dstPath.IsRoot() {
+		return NotFound
+	}
 
-	src, _,srcerr := srcNode.Apply( md.SrcDocument)
-	dst, lastDstNode, dsterr := dstNode.Apply( md.DstDocument)
+	fordst, err := dstPath.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
 
-	if srcerr != nil {
-		return srcerr
+	return replaceChild(fordst, dstPath.Last(), src)
+}
+
+//Inserts src element into dst array at position given by insertIndex
+func (md * MergeDocuments) insertArrayElement(srcPath Path, dstPath Path, insertIndex func(Path, []interface{}) int) error {
+	src, err := srcPath.Resolve(md.SrcDocument)
+	if err != nil {
+		return err
 	}
-	if dsterr != nil {
-		return dsterr
+
+	dst, err := dstPath.Resolve(md.DstDocument)
+	if err != nil {
+		return err
 	}
 
-	prevNode := lastDstNode.GetPrev();
-	prevNode.SetNext(nil)
+	dstArr, ok := dst.([]interface{})
+	if !ok {
+		return ArrayTypeError
+	}
 
-	if prevNode == nil {
+	if dstPath.IsRoot() {
 		return NotFound
 	}
 
-	_ = dst
-
-	fordst, _, err := dstNode.Apply( md.DstDocument)
-
+	fordst, err := dstPath.Parent().Resolve(md.DstDocument)
 	if err != nil {
 		return err
 	}
 
-	fordst.([]interface{})[lastDstNode.GetKey().(int)] = src
+	index := insertIndex(srcPath, dstArr)
 
-	return nil
+	finArr := make([]interface{}, 0, len(dstArr) + 1)
+	finArr = append(finArr, dstArr[:index]...)
+	finArr = append(finArr, src)
+	finArr = append(finArr, dstArr[index:]...)
+
+	return replaceChild(fordst, dstPath.Last(), finArr)
 }
 
-func (md * MergeDocuments) addArrayElement(srcNode Node, dstNode Node) error {
-	src, _, srcerr := srcNode.Apply(md.SrcDocument)
-	dst, lastDstNode, dsterr := dstNode.Apply(md.DstDocument)
+func (md * MergeDocuments) addArrayElement(srcPath Path, dstPath Path) error {
+	return md.insertArrayElement(srcPath, dstPath, md.insertIndex)
+}
 
-	if srcerr != nil {
-		return srcerr
-	}
-	if dsterr != nil {
-		return dsterr
+//Adds element of src array without identity at its src index, other nodes are merged by MergeByJSONPath
+//Used for differences of arrays compared by longest common subsequence,
+//their adds applied in ascending order after deletes restore src order of elements
+func (md * MergeDocuments) addSimilarElement(identities []ArrayIdentity, objectKeyName string, srcPath string, dstPath string) error {
+	srcSel, srcerr := ParsePath(srcPath)
+	dstSel, dsterr := ParsePath(dstPath)
+	if srcerr != nil || dsterr != nil || srcSel.IsRoot() || srcSel.IsPattern() || dstSel.IsPattern() {
+		return md.MergeByJSONPath(srcPath, dstPath)
 	}
 
-	prevNode := lastDstNode.GetPrev();
-	prevNode.SetNext(nil)
-
-	if prevNode == nil {
-		return NotFound
+	srcSel = srcSel.bindLast(md.SrcDocument)
+	if _, ok := srcSel.Last().(*ArraySelection); !ok {
+		return md.MergeByJSONPath(srcPath, dstPath)
 	}
-	fordst, _, err := dstNode.Apply(md.DstDocument)
 
+	fromsrc, err := srcSel.Parent().Resolve(md.SrcDocument)
 	if err != nil {
 		return err
 	}
 
-	fordst.(map[string]interface{})[lastDstNode.GetKey().(string)] = append(dst.([]interface{}), src)
+	srcArr, _ := fromsrc.([]interface{})
+	if hasIdentities(arrayIdentity(identities, objectKeyName, md.SrcDocument, srcSel.Parent().String()), srcArr) {
+		return md.MergeByJSONPath(srcPath, dstPath)
+	}
 
-	return nil
+	return md.insertArrayElement(srcSel, dstSel.bindLast(md.DstDocument), func(srcPath Path, dstArr []interface{}) int {
+		if srcIndex, err := arrayIndex(srcPath.Last(), srcArr); err == nil && srcIndex < len(dstArr) {
+			return srcIndex
+		}
+		return len(dstArr)
+	})
 }
 
-func (md * MergeDocuments) deleteArrayElement(dstNode Node) error {
-	_, lastDstNode, err := dstNode.Apply(md.DstDocument)
-
-	if err != nil {
-		return err
+//Checks whether any element of array has identity
+func hasIdentities(identity IdentityFunc, arr []interface{}) bool {
+	for _, item := range arr {
+		if _, ok := identity(item); ok {
+			return true
+		}
 	}
+	return false
+}
 
-	prevNode := lastDstNode.GetPrev()
-	prevNode.SetNext(nil)
+//Gets position in dst array for element added from src
+//Element goes right after the nearest preceding sibling with do_objectID present in dst,
+//or right before the nearest following one, elements without such siblings are appended
+func (md * MergeDocuments) insertIndex(srcPath Path, dstArr []interface{}) int {
+	if srcPath.IsRoot() {
+		return len(dstArr)
+	}
 
-	if prevNode == nil {
-		return NotFound
+	fromsrc, err := srcPath.Parent().Resolve(md.SrcDocument)
+	if err != nil {
+		return len(dstArr)
 	}
 
-	fordst, arrLastNode, err := dstNode.Apply(md.DstDocument)
+	srcArr, ok := fromsrc.([]interface{})
+	if !ok {
+		return len(dstArr)
+	}
 
+	srcIndex, err := arrayIndex(srcPath.Last(), srcArr)
 	if err != nil {
-		return err
+		return len(dstArr)
 	}
 
-	prevNode = prevNode.GetPrev()
-	prevNode.SetNext(nil)
+	for i := srcIndex - 1; i >= 0; i-- {
+		if index := siblingIndex(srcArr[i], dstArr); index != -1 {
+			return index + 1
+		}
+	}
 
-	if prevNode == nil {
-		return NotFound
+	for i := srcIndex + 1; i < len(srcArr); i++ {
+		if index := siblingIndex(srcArr[i], dstArr); index != -1 {
+			return index
+		}
 	}
 
-	findst, _, finerr := dstNode.Apply(md.DstDocument)
+	return len(dstArr)
+}
 
-	if finerr != nil {
-		return finerr
+//Gets index of src sibling in dst array by its do_objectID or -1
+func siblingIndex(sibling interface{}, dstArr []interface{}) int {
+	siblingMap, isMap := sibling.(map[string]interface{})
+	if !isMap {
+		return -1
 	}
 
-	index := lastDstNode.GetKey().(int)
-	finArr := append(fordst.([]interface{})[:index], fordst.([]interface{})[index+1:]...)
-	//fmt.Printf("Err: %v %v\n", arrLastNode.GetKey(), findst)
-	findst.(map[string]interface{})[arrLastNode.GetKey().(string)] = finArr
-	return nil
+	objectID, ok := siblingMap["do_objectID"].(string)
+	if !ok {
+		return -1
+	}
+
+	return indexOfObject("do_objectID", objectID, dstArr)
 }
 
-func (md * MergeDocuments) addMapElement(srcNode Node, dstNode Node) error {
-	src, lastSrcNode, srcerr := srcNode.Apply(md.SrcDocument)
-	dst, _, dsterr := dstNode.Apply(md.DstDocument)
+func (md * MergeDocuments) deleteArrayElement(dstPath Path) error {
+	arrPath := dstPath.Parent()
+	if dstPath.IsRoot() || arrPath.IsRoot() {
+		return NotFound
+	}
 
-	if srcerr != nil {
-		return srcerr
+	fordst, err := arrPath.Resolve(md.DstDocument)
+	if err != nil {
+		return err
 	}
 
-	if dsterr != nil {
-		return dsterr
+	dstArr, ok := fordst.([]interface{})
+	if !ok {
+		return ArrayTypeError
 	}
 
-	key := lastSrcNode.GetKey()
+	index, err := arrayIndex(dstPath.Last(), dstArr)
+	if err != nil {
+		return err
+	}
 
-	dst.(map[string]interface{})[key.(string)] = src
+	findst, err := arrPath.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	finArr := append(dstArr[:index], dstArr[index+1:]...)
+
+	return replaceChild(findst, arrPath.Last(), finArr)
 }
 
-func (md * MergeDocuments) setMapElement(srcNode Node, dstNode Node) error {
-	src, lastSrcNode, srcerr := srcNode.Apply(md.SrcDocument)
-	_, lastDstNode, dsterr := dstNode.Apply(md.DstDocument)
+func (md * MergeDocuments) addMapElement(srcPath Path, dstPath Path) error {
+	src, err := srcPath.Resolve(md.SrcDocument)
+	if err != nil {
+		return err
+	}
 
-	if srcerr != nil {
-		return srcerr
+	dst, err := dstPath.Resolve(md.DstDocument)
+	if err != nil {
+		return err
 	}
 
-	if dsterr != nil {
-		return dsterr
+	return replaceChild(dst, srcPath.Last(), src)
+}
+
+func (md * MergeDocuments) setMapElement(srcPath Path, dstPath Path) error {
+	src, err := srcPath.Resolve(md.SrcDocument)
+	if err != nil {
+		return err
 	}
-	prevNode := lastDstNode.GetPrev();
-	prevNode.SetNext(nil)
 
-	if prevNode == nil {
+	if dstPath.IsRoot() {
 		return NotFound
 	}
 
+	fordst, err := dstPath.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
+
+	return replaceChild(fordst, dstPath.Last(), src)
+}
 
-	fordst, _, err := dstNode.Apply(md.DstDocument)
+func (md * MergeDocuments) deleteMapElement(dstPath Path) error {
+	mapNode, ok := dstPath.Last().(*MapSelection)
+	if !ok {
+		return NotFound
+	}
 
+	fordst, err := dstPath.Parent().Resolve(md.DstDocument)
 	if err != nil {
 		return err
 	}
 
-	key := lastSrcNode.GetKey()
-
-	fordst.(map[string]interface{})[key.(string)] = src
+	dstMap, ok := fordst.(map[string]interface{})
+	if !ok {
+		return MapTypeError
+	}
 
+	delete(dstMap, mapNode.Key)
 
 	return nil
 }
 
-func (md * MergeDocuments) deleteMapElement(dstNode Node) error {
-	_, lastDstNode, err := dstNode.Apply(md.DstDocument)
-	key := lastDstNode.GetKey()
-
+//Sets value of the node at dstPath of destination document
+func (md * MergeDocuments) SetByJSONPath(dstPath string, value interface{}) error {
+	path, err := ParsePath(dstPath)
 	if err != nil {
 		return err
 	}
 
-	prevNode := lastDstNode.GetPrev();
-	prevNode.SetNext(nil)
-
-	if prevNode == nil {
+	if path.IsRoot() {
 		return NotFound
 	}
 
-	fordst, _, err := dstNode.Apply(md.DstDocument)
-
-	delete(fordst.(map[string]interface{}), key.(string))
+	parent, err := path.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return replaceChild(parent, path.Last(), value)
 }
 
-
-
 func (md * MergeDocuments) MergeByJSONPath(srcPath string, dstPath string) error {
 
-	srcSel, srcact, srcerr := Parse(srcPath)
-	dstSel, dstact, dsterr := Parse(dstPath)
+	srcSel, srcerr := ParsePath(srcPath)
+	dstSel, dsterr := ParsePath(dstPath)
 
 	if srcerr != nil {
 		return srcerr
@@ -483,20 +688,30 @@ func (md * MergeDocuments) MergeByJSONPath(srcPath string, dstPath string) error
 		return dsterr
 	}
 
-	_, lastSrcNode, srcerr := srcSel.Apply(md.SrcDocument)
+	if srcSel.IsPattern() || dstSel.IsPattern() {
+		return md.mergeByPattern(srcPath, dstPath)
+	}
 
-	if srcerr != nil {
+	if _, srcerr := srcSel.Resolve(md.SrcDocument); srcerr != nil {
 		return srcerr
 	}
 
+	//index tokens of JSON Pointer may select map properties
+	srcSel = srcSel.bindLast(md.SrcDocument)
+	dstSel = dstSel.bindLast(md.DstDocument)
+
+	srcact := srcSel.Action()
+	lastSrcNode := srcSel.Last()
+
 	if srcPath == "" {
-		srcact = dstact
-		_, lastSrcNode, srcerr = dstSel.Apply(md.DstDocument)
+		srcact = dstSel.Action()
+		lastSrcNode = dstSel.Last()
 	}
 
-	switch selType := lastSrcNode.(type) {
+	switch lastSrcNode.(type) {
+	case nil:
+		return NotFound
 	default:
-		_ = selType
 		return md.setMapElement(srcSel, dstSel)
 	case *MapSelection:
 		if srcact == ValueDelete {
@@ -508,7 +723,7 @@ func (md * MergeDocuments) MergeByJSONPath(srcPath string, dstPath string) error
 		}
 
 		return md.setMapElement(srcSel, dstSel)
-	case *ArraySelection:
+	case *ArraySelection, *ObjectIDSelection:
 		if srcact == ValueDelete {
 			return md.deleteArrayElement(dstSel)
 		}
@@ -520,16 +735,62 @@ func (md * MergeDocuments) MergeByJSONPath(srcPath string, dstPath string) error
 		return md.setArrayElement(srcSel, dstSel)
 
 	}
+}
+
+func (md * MergeDocuments) MergeSequenceByJSONPath(objectKeyName string, srcPath string, dstPath string) error {
+	return md.MergeSequenceBy(KeyIdentity(objectKeyName), srcPath, dstPath)
+}
 
+//Gets indices of dst elements in their order by src array
+//Elements present in both arrays take slots they occupy in dst in order of src, other elements keep their positions
+func sequenceOrder(identity IdentityFunc, srcArr []interface{}, dstArr []interface{}) []int {
+	//build id associations by identity
+	doc1Changes, doc2Changes := CompareSequenceBy(identity, srcArr, dstArr)
 
+	srcIndices := make([]int, 0, len(doc1Changes))
+	for idxDoc1, idxDoc2 := range doc1Changes {
+		if idxDoc2 != -1 {
+			srcIndices = append(srcIndices, idxDoc1)
+		}
+	}
+	sort.Ints(srcIndices)
 
-	return nil
+	slots := make([]int, 0, len(doc2Changes))
+	for idxDoc2, idxDoc1 := range doc2Changes {
+		if idxDoc1 != -1 {
+			slots = append(slots, idxDoc2)
+		}
+	}
+	sort.Ints(slots)
+
+	order := make([]int, len(dstArr))
+	for i := range order {
+		order[i] = i
+	}
+	for i, slot := range slots {
+		order[slot] = doc1Changes[srcIndices[i]]
+	}
+	return order
 }
 
-func (md * MergeDocuments) MergeSequenceByJSONPath(objectKeyName string, srcPath string, dstPath string) error {
+//Orders elements of dst array as elements with the same identity in src array, elements only in dst keep their positions
+func (md * MergeDocuments) MergeSequenceBy(identity IdentityFunc, srcPath string, dstPath string) error {
+
+	if IsPattern(srcPath) {
+		srcPaths, err := ExpandJSONPath(md.SrcDocument, srcPath)
+		if err != nil {
+			return err
+		}
+		for _, path := range srcPaths {
+			if err := md.MergeSequenceBy(identity, path, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-	srcSel, _, srcerr := Parse(srcPath)
-	dstSel, _, dsterr := Parse(dstPath)
+	srcSel, srcerr := ParsePath(srcPath)
+	dstSel, dsterr := ParsePath(dstPath)
 
 	if srcerr != nil {
 		return srcerr
@@ -539,51 +800,27 @@ func (md * MergeDocuments) MergeSequenceByJSONPath(objectKeyName string, srcPath
 		return dsterr
 	}
 
-	fordst, _, fderr := dstSel.Apply(md.DstDocument)
+	fordst, fderr := dstSel.Resolve(md.DstDocument)
 	if fderr != nil {
 		return fderr;
 	}
 
-	forsrc, _, fserr := srcSel.Apply(md.SrcDocument)
+	forsrc, fserr := srcSel.Resolve(md.SrcDocument)
 	if fserr != nil {
 		return fserr;
 	}
 
-	//build id associations by objectID
-	doc1Changes, _ := CompareSequence(objectKeyName, forsrc.([]interface{}), fordst.([]interface{}))
-
-	slice := fordst.([]interface{})
-	newslice := make([]interface{}, len(slice))
-
-	for idxDoc1, idxDoc2 := range doc1Changes {
-		if idxDoc2 == -1 {
-			log.Printf("no doc2 pos %v %v\n", idxDoc1, idxDoc2)
-			continue
-		}
-
-
-		if idxDoc1 < len(newslice) {
-			newslice[idxDoc1] = slice[idxDoc2]
-			slice[idxDoc2] = nil
-		} else {
-			log.Printf("Sequence out of range %v %v\n", idxDoc1, len(slice))
-		}
+	srcArr, isSrcArr := forsrc.([]interface{})
+	dstArr, isDstArr := fordst.([]interface{})
+	if !isSrcArr || !isDstArr {
+		return ArrayTypeError
 	}
 
-	j := 0
-	for i := range newslice {
-		if newslice[i] == nil {
-			for k:=j ; k<len(slice); k++ {
-				if slice[k] != nil {
-					newslice[i] = slice[k]
-					slice[k] = nil
-					j = k + 1
-				}
-			}
-		}
+	ordered := make([]interface{}, len(dstArr))
+	for slot, index := range sequenceOrder(identity, srcArr, dstArr) {
+		ordered[slot] = dstArr[index]
 	}
-
-	copy(slice, newslice)
+	copy(dstArr, ordered)
 
 	return nil
 }
@@ -0,0 +1,579 @@
+package sketchmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Three-way merge of json documents sharing a common ancestor
+type MergeDocuments3 struct {
+	BaseDocument map[string]interface{}
+	OursDocument map[string]interface{}
+	TheirsDocument map[string]interface{}
+	//conflicting changes found by Merge
+	Conflicts []Conflict
+	//resolution of conflicting changes, ours are kept if not set
+	Policy *MergePolicy
+	//theirs document is newer than ours by IsTheirsNewer, used by ResolveNewest
+	TheirsNewer bool
+}
+
+//Kind of change made to base document
+const (
+	baseValueChange = iota
+	baseDeleteChange
+	baseInsertChange
+	baseSequenceChange
+)
+
+//Path in base document touched by a change
+type baseChange struct {
+	path string
+	//path of changed node in the document of the side, empty for deletes
+	sidePath string
+	kind int
+}
+
+func (bc baseChange) isValueChange() bool {
+	return bc.kind == baseValueChange || bc.kind == baseDeleteChange
+}
+
+//Checks whether prefix addresses the same node as path or one of its ancestors
+func isPathPrefix(prefix string, path string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '[' || path[len(prefix)] == '/'
+}
+
+func (bc baseChange) overlaps(other baseChange) bool {
+	if bc.isValueChange() && other.isValueChange() {
+		return isPathPrefix(bc.path, other.path) || isPathPrefix(other.path, bc.path)
+	}
+	if bc.isValueChange() {
+		return isPathPrefix(bc.path, other.path)
+	}
+	if other.isValueChange() {
+		return isPathPrefix(other.path, bc.path)
+	}
+	//inserts never overlap each other, sequence changes overlap when reordering the same container
+	return bc.kind == baseSequenceChange && other.kind == baseSequenceChange && bc.path == other.path
+}
+
+//Gets the base path touched by a diff entry of the side compared against base
+func diffBaseChange(key string, item string) (baseChange, error) {
+	if isDeleteDiff(key) {
+		return baseChange{path: strings.TrimPrefix(key, "-"), kind: baseDeleteChange}, nil
+	}
+
+	if !strings.HasPrefix(key, "+") {
+		return baseChange{path: item, sidePath: key}, nil
+	}
+
+	sel, _, err := Parse(key)
+	if err != nil {
+		return baseChange{}, err
+	}
+
+	switch lastNode := sel.(*RootNode).GetLast().(type) {
+	case *MapSelection:
+		return baseChange{path: item + KeySegment(lastNode.Key), sidePath: key[1:]}, nil
+	default:
+		return baseChange{path: item, sidePath: key[1:], kind: baseInsertChange}, nil
+	}
+}
+
+func diffBaseChanges(diff *JsonStructureCompare) []baseChange {
+	changes := make([]baseChange, 0, len(diff.Doc1Diffs) + len(diff.Doc1SeqDiffs))
+	for key, item := range diff.Doc1Diffs {
+		change, err := diffBaseChange(key, item.(string))
+		if err != nil {
+			log.Printf("Skipping diff entry %v: %v\n", key, err)
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for key, item := range diff.Doc1SeqDiffs {
+		changes = append(changes, baseChange{path: item.(string), sidePath: key, kind: baseSequenceChange})
+	}
+	return changes
+}
+
+func findOverlap(change baseChange, changes []baseChange) (baseChange, bool) {
+	for _, other := range changes {
+		if change.overlaps(other) {
+			return other, true
+		}
+	}
+	return baseChange{}, false
+}
+
+//Records conflict if change of theirs overlaps with a change of ours
+//Returns whether changes overlap and the strategy resolving them
+func (md3 *MergeDocuments3) checkConflict(theirsChange baseChange, oursChanges []baseChange) (bool, ResolutionStrategy) {
+	oursChange, ok := findOverlap(theirsChange, oursChanges)
+	if !ok {
+		return false, ""
+	}
+
+	conflict, isConflict := md3.newConflict(oursChange, theirsChange)
+	if !isConflict {
+		return true, ResolveOurs
+	}
+
+	conflict.Resolution = md3.strategy(conflict.JsonPath)
+
+	if conflict.Resolution == ResolveUnion {
+		if err := md3.applyUnion(oursChange, theirsChange); err != nil {
+			log.Printf("Keeping ours for conflicting change %v: %v\n", conflict.JsonPath, err)
+			conflict.Resolution = ResolveOurs
+		}
+	}
+
+	md3.Conflicts = append(md3.Conflicts, conflict)
+	return true, conflict.Resolution
+}
+
+//Selects strategy of policy for conflicting node at path of base document, newest side is known here
+func (md3 *MergeDocuments3) strategy(path string) ResolutionStrategy {
+	strategy := md3.Policy.Strategy(md3.BaseDocument, path)
+	if strategy != ResolveNewest {
+		return strategy
+	}
+
+	if md3.TheirsNewer {
+		return ResolveTheirs
+	}
+	return ResolveOurs
+}
+
+//Falls back to ours for the last conflict if theirs change can't be applied
+func (md3 *MergeDocuments3) keepOurs(key string, err error) {
+	log.Printf("Keeping ours for conflicting change %v: %v\n", key, err)
+	md3.Conflicts[len(md3.Conflicts)-1].Resolution = ResolveOurs
+}
+
+//Replaces ours node with the union of children of ours and theirs nodes
+func (md3 *MergeDocuments3) applyUnion(oursChange baseChange, theirsChange baseChange) error {
+	if !oursChange.isValueChange() || oursChange.kind == baseDeleteChange || theirsChange.kind == baseDeleteChange {
+		return NotFound
+	}
+
+	union, ok := unionOfChildren("do_objectID", changeValue(md3.OursDocument, oursChange), changeValue(md3.TheirsDocument, theirsChange))
+	if !ok {
+		return MapTypeError
+	}
+
+	mergeDoc := MergeDocuments{nil, md3.OursDocument}
+	return mergeDoc.SetByJSONPath(oursChange.sidePath, union)
+}
+
+//Gets index of array element having objectKeyName equal to objectKeyValue
+func indexOfObject(objectKeyName string, objectKeyValue interface{}, arr []interface{}) int {
+	for index, item := range arr {
+		if itemMap, isMap := item.(map[string]interface{}); isMap && itemMap[objectKeyName] == objectKeyValue {
+			return index
+		}
+	}
+	return -1
+}
+
+//Compares numeric array indices of two jsonpaths so elements of one array are ordered by index
+func lessPath(path1 string, path2 string) bool {
+	sel1, _, err1 := Parse(path1)
+	sel2, _, err2 := Parse(path2)
+	if err1 != nil || err2 != nil {
+		return path1 < path2
+	}
+
+	node1, node2 := sel1.GetNext(), sel2.GetNext()
+	for node1 != nil && node2 != nil {
+		idx1, isIdx1 := node1.GetKey().(int)
+		idx2, isIdx2 := node2.GetKey().(int)
+		if isIdx1 && isIdx2 {
+			if idx1 != idx2 {
+				return idx1 < idx2
+			}
+		} else if key1, key2 := toString(node1.GetKey()), toString(node2.GetKey()); key1 != key2 {
+			return key1 < key2
+		}
+		node1, node2 = node1.GetNext(), node2.GetNext()
+	}
+	return node2 != nil
+}
+
+func toString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case int:
+		return strconv.Itoa(k)
+	}
+	return ""
+}
+
+//Merges changes made in theirs document since base into ours document
+//Changes of theirs overlapping with changes of ours are reported as conflicts and resolved by Policy
+func (md3 *MergeDocuments3) Merge() error {
+	//elements are addressed by object key so base paths stay valid in ours document
+	oursDiff := NewJsonStructureCompare()
+	oursDiff.Options.ObjectIDPaths = true
+	oursDiff.Compare(md3.OursDocument, md3.BaseDocument, "$")
+
+	theirsDiff := NewJsonStructureCompare()
+	theirsDiff.Options.ObjectIDPaths = true
+	theirsDiff.Compare(md3.TheirsDocument, md3.BaseDocument, "$")
+
+	oursChanges := diffBaseChanges(oursDiff)
+
+	mergeDoc := MergeDocuments{md3.TheirsDocument, md3.OursDocument}
+
+	keys := make([]string, 0, len(theirsDiff.Doc1Diffs))
+	for key := range theirsDiff.Doc1Diffs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	deleteActions := make([]string, 0)
+	for _, key := range keys {
+		item := theirsDiff.Doc1Diffs[key].(string)
+		change, err := diffBaseChange(key, item)
+		if err != nil {
+			return err
+		}
+
+		isConflict, strategy := md3.checkConflict(change, oursChanges)
+		if isConflict && strategy != ResolveTheirs {
+			continue
+		}
+
+		if isDeleteDiff(key) {
+			deleteActions = append(deleteActions, key)
+			continue
+		}
+
+		err = mergeDoc.MergeByJSONPath(key, item)
+		if err != nil && isConflict {
+			md3.keepOurs(key, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	//delete elements starting from the end of arrays so indices of elements without object key stay valid
+	sort.Slice(deleteActions, func(i, j int) bool {
+		return lessPath(deleteActions[j], deleteActions[i])
+	})
+
+	for _, dstPath := range deleteActions {
+		if err := mergeDoc.MergeByJSONPath("", dstPath); err != nil && err != NotFound {
+			return err
+		}
+	}
+
+	seqKeys := make([]string, 0, len(theirsDiff.Doc1SeqDiffs))
+	for key := range theirsDiff.Doc1SeqDiffs {
+		seqKeys = append(seqKeys, key)
+	}
+	sort.Strings(seqKeys)
+
+	for _, key := range seqKeys {
+		item := theirsDiff.Doc1SeqDiffs[key]
+		isConflict, strategy := md3.checkConflict(baseChange{path: item.(string), sidePath: key, kind: baseSequenceChange}, oursChanges)
+		if isConflict && strategy != ResolveTheirs {
+			continue
+		}
+
+		identity := arrayIdentity(theirsDiff.Options.arrayIdentities(), theirsDiff.ObjectKeyName, md3.TheirsDocument, key)
+		err := mergeDoc.MergeSequenceBy(identity, key, item.(string))
+
+		if err != nil && isConflict {
+			md3.keepOurs(key, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Opens sketch file or directory in working directory
+func prepareSketchDir(sketchFile string) (string, bool, error) {
+	sketchFileInfo, err := os.Stat(sketchFile)
+	if err != nil {
+		return "", false, err
+	}
+
+	if sketchFileInfo.IsDir() {
+		return sketchFile, true, nil
+	}
+
+	workingDir, err := prepareWorkingDir(true)
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := Unzip(sketchFile, workingDir); err != nil {
+		removeWorkingDir(workingDir, false)
+		return "", false, err
+	}
+
+	return workingDir, false, nil
+}
+
+//Merges changes of files of theirs dir made since base into ours dir and stages merged files in transaction
+//Files added or deleted by one side are copied or removed, pages indexes are rebuilt from the merged page set
+func mergeActions3(workingDirBase string, workingDirOurs string, workingDirTheirs string, policy *MergePolicy, tx *fileTransaction) ([]Conflict, error) {
+	theirsNewer := false
+	oursMeta, errOurs := readJSON(workingDirOurs + string(os.PathSeparator) + "meta.json")
+	theirsMeta, errTheirs := readJSON(workingDirTheirs + string(os.PathSeparator) + "meta.json")
+	if errOurs == nil && errTheirs == nil {
+		theirsNewer = IsTheirsNewer(oursMeta, theirsMeta)
+	}
+
+	baseFileStruct, oursFileStruct := ExtractSketchDirStruct(workingDirBase, workingDirOurs)
+	_, theirsFileStruct := ExtractSketchDirStruct(workingDirBase, workingDirTheirs)
+
+	conflicts := make([]Conflict, 0)
+	for _, fileKey := range mergedFileKeys(baseFileStruct, oursFileStruct, theirsFileStruct) {
+		basePath := workingDirBase + string(os.PathSeparator) + fileKey
+		oursPath := workingDirOurs + string(os.PathSeparator) + fileKey
+		theirsPath := workingDirTheirs + string(os.PathSeparator) + fileKey
+
+		var fileConflicts []Conflict
+		var err error
+		if isJSONFile(fileKey) && baseFileStruct.fileSet[fileKey] != nil && oursFileStruct.fileSet[fileKey] != nil && theirsFileStruct.fileSet[fileKey] != nil {
+			fileConflicts, err = mergeDocuments3(basePath, oursPath, theirsPath, policy, theirsNewer, tx)
+		} else {
+			fileConflicts, err = mergeFile3(basePath, oursPath, theirsPath, policy, theirsNewer, tx)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, conflict := range fileConflicts {
+			conflict.FileKey = fileKey
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	//pages indexes follow the merged page set, missing references are taken from theirs document.json
+	if err := reconcilePages(workingDirTheirs, workingDirOurs, tx, &MergeReport{}, false); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+}
+
+//Gets sorted keys of files, not directories, of any of the file sets
+func mergedFileKeys(fileStructs ...SketchFileStruct) []string {
+	fileKeys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, fileStruct := range fileStructs {
+		for fileKey, item := range fileStruct.fileSet {
+			if info, ok := item.(os.FileInfo); seen[fileKey] || (ok && info.IsDir()) {
+				continue
+			}
+			seen[fileKey] = true
+			fileKeys = append(fileKeys, fileKey)
+		}
+	}
+	sort.Strings(fileKeys)
+	return fileKeys
+}
+
+func isJSONFile(fileKey string) bool {
+	return filepath.Ext(strings.ToLower(fileKey)) == ".json"
+}
+
+//Merges json document changed since base by both sides with MergeDocuments3 and stages ours file
+func mergeDocuments3(basePath string, oursPath string, theirsPath string, policy *MergePolicy, theirsNewer bool, tx *fileTransaction) ([]Conflict, error) {
+	baseDoc, err := readJSON(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	oursDoc, err := readJSON(oursPath)
+	if err != nil {
+		return nil, err
+	}
+
+	theirsDoc, err := readJSON(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mergeDoc := MergeDocuments3{BaseDocument: baseDoc, OursDocument: oursDoc, TheirsDocument: theirsDoc, Policy: policy, TheirsNewer: theirsNewer}
+	if err := mergeDoc.Merge(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(mergeDoc.OursDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	tx.Stage(oursPath, data)
+	return mergeDoc.Conflicts, nil
+}
+
+//Merges file added, deleted or changed as a whole by one of the sides
+//Theirs change is taken if ours kept the base version, otherwise changes of both sides conflict
+func mergeFile3(basePath string, oursPath string, theirsPath string, policy *MergePolicy, theirsNewer bool, tx *fileTransaction) ([]Conflict, error) {
+	base, inBase, err := readFileVersion(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ours, inOurs, err := readFileVersion(oursPath)
+	if err != nil {
+		return nil, err
+	}
+
+	theirs, inTheirs, err := readFileVersion(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	isTheirsChanged := inTheirs != inBase || (inTheirs && !sameFileContent(basePath, base, theirs))
+	isOursChanged := inOurs != inBase || (inOurs && !sameFileContent(basePath, base, ours))
+	isSameChange := inOurs == inTheirs && (!inOurs || sameFileContent(basePath, ours, theirs))
+
+	if !isTheirsChanged || isSameChange {
+		return nil, nil
+	}
+
+	if !isOursChanged {
+		stageFileVersion(oursPath, theirs, inTheirs, tx)
+		return nil, nil
+	}
+
+	conflict := Conflict{JsonPath: "$", Type: BothChanged}
+	switch {
+	case !inOurs:
+		conflict.Type = OursDeleted
+	case !inTheirs:
+		conflict.Type = TheirsDeleted
+	}
+
+	md3 := MergeDocuments3{Policy: policy, TheirsNewer: theirsNewer}
+	if isJSONFile(basePath) && inBase {
+		md3.BaseDocument, _ = readJSON(basePath)
+	}
+	conflict.Resolution = md3.strategy(conflict.JsonPath)
+
+	switch conflict.Resolution {
+	case ResolveTheirs:
+		stageFileVersion(oursPath, theirs, inTheirs, tx)
+	case ResolveUnion:
+		//file deleted by one side is kept with changes of the other one, files changed by both can't be united
+		if conflict.Type == OursDeleted {
+			stageFileVersion(oursPath, theirs, inTheirs, tx)
+		} else {
+			conflict.Resolution = ResolveOurs
+		}
+	}
+
+	return []Conflict{conflict}, nil
+}
+
+//Reads file of one side, false if the side has no such file
+func readFileVersion(path string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+//Stages file of dst side with content of the other side or its removal
+func stageFileVersion(path string, data []byte, exists bool, tx *fileTransaction) {
+	if exists {
+		tx.Stage(path, data)
+	} else {
+		tx.Remove(path)
+	}
+}
+
+//Checks whether two versions of file have the same content, json files are compared by their documents
+func sameFileContent(path string, data1 []byte, data2 []byte) bool {
+	if bytes.Equal(data1, data2) {
+		return true
+	}
+
+	if !isJSONFile(path) {
+		return false
+	}
+
+	var doc1, doc2 interface{}
+	if json.Unmarshal(data1, &doc1) != nil || json.Unmarshal(data2, &doc2) != nil {
+		return false
+	}
+	return reflect.DeepEqual(doc1, doc2)
+}
+
+//Merges changes of ours and theirs sketch files made since base sketch file
+//Merged document replaces ours directory or is written to outputDir if ours is a sketch file
+//Conflicting changes are resolved by policy and written to the conflicts report next to the merged document
+func ProcessFileMerge3(sketchFileBase string, sketchFileOurs string, sketchFileTheirs string, outputDir string, policy *MergePolicy) ([]Conflict, error) {
+
+	workingDirBase, isBaseDir, err := prepareSketchDir(sketchFileBase)
+	if err != nil {
+		return nil, err
+	}
+	defer removeWorkingDir(workingDirBase, isBaseDir)
+
+	workingDirOurs, isOursDir, err := prepareSketchDir(sketchFileOurs)
+	if err != nil {
+		return nil, err
+	}
+	defer removeWorkingDir(workingDirOurs, isOursDir)
+
+	workingDirTheirs, isTheirsDir, err := prepareSketchDir(sketchFileTheirs)
+	if err != nil {
+		return nil, err
+	}
+	defer removeWorkingDir(workingDirTheirs, isTheirsDir)
+
+	tx := newFileTransaction()
+
+	conflicts, err := mergeActions3(workingDirBase, workingDirOurs, workingDirTheirs, policy, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	//ours files are written all at once, so failed merge leaves ours untouched
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	//trailing separator of ours directory would put the report inside of it
+	oursPath := filepath.Clean(sketchFileOurs)
+	reportDir := outputDir
+	if reportDir == "" {
+		reportDir = filepath.Dir(oursPath)
+	}
+	reportFile := reportDir + string(os.PathSeparator) + strings.TrimSuffix(filepath.Base(oursPath), filepath.Ext(oursPath)) + ".conflicts.json"
+
+	if err := WriteConflicts(reportFile, conflicts); err != nil {
+		return nil, err
+	}
+
+	if !isOursDir {
+		sketchFile := outputDir + string(os.PathSeparator) + filepath.Base(oursPath)
+		if err := Zipit(workingDirOurs, sketchFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return conflicts, nil
+}
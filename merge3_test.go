@@ -0,0 +1,385 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMergeDocuments3_Merge(t *testing.T) {
+	var base, ours, theirs map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{
+		"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "frame": {"x": 0, "y": 0}},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2", "frame": {"x": 0, "y": 0}},
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3", "frame": {"x": 0, "y": 0}}
+		]
+	}`), &base)
+
+	err2 := json.Unmarshal([]byte(`{
+		"layers":[
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2", "frame": {"x": 0, "y": 0}},
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "ours3", "frame": {"x": 0, "y": 0}}
+		]
+	}`), &ours)
+
+	err3 := json.Unmarshal([]byte(`{
+		"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "frame": {"x": 0, "y": 0}},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2", "frame": {"x": 10, "y": 0}},
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "theirs3", "frame": {"x": 0, "y": 0}}
+		]
+	}`), &theirs)
+
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+	}
+
+	mergeDoc := MergeDocuments3{BaseDocument: base, OursDocument: ours, TheirsDocument: theirs}
+	if err := mergeDoc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	layers := mergeDoc.OursDocument["layers"].([]interface{})
+	if len(layers) != 2 {
+		t.Fatalf("Expected 2 layers, got %v", len(layers))
+	}
+
+	if x := layers[0].(map[string]interface{})["frame"].(map[string]interface{})["x"]; x != float64(10) {
+		t.Errorf("Expected non-overlapping change of theirs to be merged, got x=%v", x)
+	}
+
+	if name := layers[1].(map[string]interface{})["name"]; name != "ours3" {
+		t.Errorf("Expected overlapping change to keep ours value, got %v", name)
+	}
+
+	if len(mergeDoc.Conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %v", len(mergeDoc.Conflicts))
+	}
+
+	conflict := mergeDoc.Conflicts[0]
+	if conflict.Type != BothChanged || conflict.OursValue != "ours3" || conflict.TheirsValue != "theirs3" {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+}
+
+func TestMergeDocuments3_DeleteConflict(t *testing.T) {
+	var base, ours, theirs map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"name": "page", "do_objectID": "AE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "_class": "artboard", "layers": [
+				{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2"}
+			]}
+		]}`), &base)
+	err2 := json.Unmarshal([]byte(`{"name": "page", "do_objectID": "AE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "_class": "artboard", "layers": []}
+		]}`), &ours)
+	err3 := json.Unmarshal([]byte(`{"name": "page", "do_objectID": "AE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "_class": "artboard", "layers": [
+				{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "renamed"}
+			]}
+		]}`), &theirs)
+
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+	}
+
+	mergeDoc := MergeDocuments3{BaseDocument: base, OursDocument: ours, TheirsDocument: theirs}
+	if err := mergeDoc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if len(mergeDoc.Conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, got %v", len(mergeDoc.Conflicts))
+	}
+
+	conflict := mergeDoc.Conflicts[0]
+	if conflict.Type != OursDeleted || conflict.TheirsValue != "renamed" {
+		t.Errorf("Unexpected conflict %+v", conflict)
+	}
+
+	if conflict.PageName != "page" || conflict.ArtboardName != "test1" || conflict.LayerName != "test2" {
+		t.Errorf("Unexpected conflict owner %+v", conflict.SketchLayerInfo)
+	}
+}
+
+func TestMergeDocuments3_Policy(t *testing.T) {
+	var base, ours, theirs map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "text", "name": "test1", "frame": {"x": 0}, "style": {"opacity": 1}},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "group", "name": "test2", "layers": [
+				{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"}
+			]}
+		]}`), &base)
+	err2 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "text", "name": "ours1", "frame": {"x": 1}, "style": {"opacity": 0.5}},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "group", "name": "test2", "layers": [
+				{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"},
+				{"do_objectID": "2E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "ours4"}
+			]}
+		]}`), &ours)
+	err3 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "text", "name": "theirs1", "frame": {"x": 2}, "style": {"opacity": 0.2}},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "_class": "group", "name": "test2", "layers": [
+				{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"}
+			]}
+		]}`), &theirs)
+
+	if err1 != nil || err2 != nil || err3 != nil {
+		t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+	}
+
+	policy := &MergePolicy{Default: ResolveOurs, Rules: []ResolutionRule{
+		{Key: "style", Strategy: ResolveTheirs},
+		{Key: "frame", Strategy: ResolveOurs},
+		{Class: "text", Strategy: ResolveNewest},
+	}}
+
+	mergeDoc := MergeDocuments3{BaseDocument: base, OursDocument: ours, TheirsDocument: theirs, Policy: policy, TheirsNewer: true}
+	if err := mergeDoc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	layer := mergeDoc.OursDocument["layers"].([]interface{})[0].(map[string]interface{})
+	if opacity := layer["style"].(map[string]interface{})["opacity"]; opacity != 0.2 {
+		t.Errorf("Expected theirs style, got opacity=%v", opacity)
+	}
+	if x := layer["frame"].(map[string]interface{})["x"]; x != float64(1) {
+		t.Errorf("Expected ours frame, got x=%v", x)
+	}
+	if name := layer["name"]; name != "theirs1" {
+		t.Errorf("Expected newest name, got %v", name)
+	}
+
+	if len(mergeDoc.Conflicts) != 3 {
+		t.Errorf("Expected 3 conflicts, got %v", len(mergeDoc.Conflicts))
+	}
+}
+
+func TestMergeDocuments3_ReorderOverrideValues(t *testing.T) {
+	decode := func(order string) map[string]interface{} {
+		var result map[string]interface{}
+		values := map[rune]string{'a': `{"overrideName": "a", "value": "1"}`, 'b': `{"overrideName": "b", "value": "2"}`, 'c': `{"overrideName": "c", "value": "3"}`}
+		doc := `{"layers": [{"do_objectID": "S", "_class": "symbolInstance", "overrideValues": [`
+		for i, name := range order {
+			if i > 0 {
+				doc += ", "
+			}
+			doc += values[name]
+		}
+		if err := json.Unmarshal([]byte(doc + `]}]}`), &result); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+		return result
+	}
+	overrideNames := func(doc map[string]interface{}) []interface{} {
+		layer := doc["layers"].([]interface{})[0].(map[string]interface{})
+		return objectKeys("overrideName", layer["overrideValues"])
+	}
+
+	//values are reordered by their override names
+	mergeDoc := MergeDocuments3{BaseDocument: decode("abc"), OursDocument: decode("abc"), TheirsDocument: decode("cab")}
+	if err := mergeDoc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if names := overrideNames(mergeDoc.OursDocument); !reflect.DeepEqual(names, []interface{}{"c", "a", "b"}) {
+		t.Errorf("Expected theirs order of override values, got %v", names)
+	}
+	if len(mergeDoc.Conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %+v", mergeDoc.Conflicts)
+	}
+
+	//different orders of both sides are conflicting
+	mergeDoc = MergeDocuments3{BaseDocument: decode("abc"), OursDocument: decode("bac"), TheirsDocument: decode("cab")}
+	if err := mergeDoc.Merge(); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if names := overrideNames(mergeDoc.OursDocument); !reflect.DeepEqual(names, []interface{}{"b", "a", "c"}) {
+		t.Errorf("Expected ours order of override values, got %v", names)
+	}
+	if len(mergeDoc.Conflicts) != 1 || mergeDoc.Conflicts[0].Type != BothReordered {
+		t.Fatalf("Expected reorder conflict, got %+v", mergeDoc.Conflicts)
+	}
+	if values := mergeDoc.Conflicts[0].TheirsValue; !reflect.DeepEqual(values, []interface{}{"c", "a", "b"}) {
+		t.Errorf("Expected override names of theirs order, got %v", values)
+	}
+}
+
+func TestNewMergePolicy(t *testing.T) {
+	doc := map[string]interface{}{"layers": []interface{}{map[string]interface{}{"_class": "text", "name": "A"}}}
+	rules := []ResolutionRule{{Path: `^\$\["layers"\]\[\d+\]\["name"\]$`, Strategy: ResolveTheirs}}
+
+	policy, err := NewMergePolicy(ResolveOurs, rules)
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	if strategy := policy.Strategy(doc, `$["layers"][0]["name"]`); strategy != ResolveTheirs {
+		t.Errorf("Expected theirs strategy by path rule, got %v", strategy)
+	}
+	if rules[0].pathReg != nil {
+		t.Errorf("Expected rules of caller left untouched")
+	}
+
+	//rules with path of policy not compiled don't match
+	uncompiled := &MergePolicy{Default: ResolveOurs, Rules: rules}
+	if strategy := uncompiled.Strategy(doc, `$["layers"][0]["name"]`); strategy != ResolveOurs || uncompiled.Rules[0].pathReg != nil {
+		t.Errorf("Expected default strategy of policy not compiled, got %v", strategy)
+	}
+
+	if _, err := NewMergePolicy("latest", nil); err != UnknownStrategy {
+		t.Errorf("Expected unknown strategy error, got %v", err)
+	}
+}
+
+func TestUnionOfChildren(t *testing.T) {
+	ours := []interface{}{
+		map[string]interface{}{"do_objectID": "1", "name": "ours"},
+		map[string]interface{}{"do_objectID": "2"},
+	}
+	theirs := []interface{}{
+		map[string]interface{}{"do_objectID": "1", "name": "theirs"},
+		map[string]interface{}{"do_objectID": "3"},
+	}
+
+	union, ok := unionOfChildren("do_objectID", ours, theirs)
+	if !ok {
+		t.Fatalf("Expected union of arrays")
+	}
+
+	unionArr := union.([]interface{})
+	if len(unionArr) != 3 || unionArr[0].(map[string]interface{})["name"] != "ours" || unionArr[2].(map[string]interface{})["do_objectID"] != "3" {
+		t.Errorf("Unexpected union %v", unionArr)
+	}
+}
+
+func TestProcessFileMerge3_Files(t *testing.T) {
+	root, err := ioutil.TempDir("", "sketchmerge-merge3")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	baseDir, oursDir, theirsDir := filepath.Join(root, "base"), filepath.Join(root, "ours"), filepath.Join(root, "theirs")
+	pageRef := func(id string) string {
+		return `{"_class": "MSJSONFileReference", "_ref_class": "MSImmutablePage", "_ref": "pages/` + id + `"}`
+	}
+
+	base := map[string]string{
+		"document.json": `{"_class": "document", "pages": [` + pageRef("A") + `, ` + pageRef("B") + `, ` + pageRef("C") + `]}`,
+		"meta.json": `{"pagesAndArtboards": {}}`,
+		"pages/A.json": `{"do_objectID": "A", "name": "A", "layers": []}`,
+		"pages/B.json": `{"do_objectID": "B", "name": "B", "layers": []}`,
+		"pages/C.json": `{"do_objectID": "C", "name": "C", "layers": []}`,
+		"images/x.png": "x",
+	}
+	writeTestFiles(t, baseDir, base)
+	writeTestFiles(t, oursDir, base)
+	writeTestFiles(t, theirsDir, base)
+
+	//ours edits page C, theirs deletes pages B and C, adds page D and replaces image
+	writeTestFiles(t, oursDir, map[string]string{"pages/C.json": `{"do_objectID": "C", "name": "ours C", "layers": []}`})
+	writeTestFiles(t, theirsDir, map[string]string{
+		"document.json": `{"_class": "document", "pages": [` + pageRef("A") + `, ` + pageRef("D") + `]}`,
+		"pages/D.json": `{"do_objectID": "D", "name": "D", "layers": []}`,
+		"images/x.png": "theirs x",
+		"images/y.png": "y",
+	})
+	os.Remove(filepath.Join(theirsDir, "pages", "B.json"))
+	os.Remove(filepath.Join(theirsDir, "pages", "C.json"))
+
+	conflicts, err := ProcessFileMerge3(baseDir, oursDir, theirsDir, root, nil)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if len(conflicts) != 1 || conflicts[0].FileKey != "pages/C.json" || conflicts[0].Type != TheirsDeleted || conflicts[0].Resolution != ResolveOurs {
+		t.Fatalf("Expected conflict of page edited by ours and deleted by theirs, got %+v", conflicts)
+	}
+
+	for name, expected := range map[string]string{"images/x.png": "theirs x", "images/y.png": "y", "pages/D.json": `{"do_objectID": "D", "name": "D", "layers": []}`} {
+		if data, err := ioutil.ReadFile(filepath.Join(oursDir, name)); err != nil || string(data) != expected {
+			t.Errorf("Expected %v of theirs, got %s %v", name, data, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(oursDir, "pages", "B.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected page deleted by theirs to be removed, got %v", err)
+	}
+	if doc, err := readJSON(filepath.Join(oursDir, "pages", "C.json")); err != nil || doc["name"] != "ours C" {
+		t.Errorf("Expected edited page of ours to be kept, got %v %v", doc, err)
+	}
+
+	doc, err := readJSON(filepath.Join(oursDir, "document.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	refs := make([]string, 0)
+	for _, ref := range objectKeys("_ref", doc["pages"]) {
+		refs = append(refs, ref.(string))
+	}
+	sort.Strings(refs)
+	if !reflect.DeepEqual(refs, []string{"pages/A", "pages/C", "pages/D"}) {
+		t.Errorf("Expected references of merged pages, got %v", refs)
+	}
+
+	meta, err := readJSON(filepath.Join(oursDir, "meta.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	if pages := sortedKeys(meta["pagesAndArtboards"].(map[string]interface{})); !reflect.DeepEqual(pages, []string{"A", "C", "D"}) {
+		t.Errorf("Expected pages and artboards of merged pages, got %v", pages)
+	}
+}
+
+func TestProcessFileMerge3_ReportOfDirectory(t *testing.T) {
+	root, err := ioutil.TempDir("", "sketchmerge-merge3")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	baseDir, oursDir, theirsDir := filepath.Join(root, "base"), filepath.Join(root, "ours"), filepath.Join(root, "theirs")
+	writeTestFiles(t, baseDir, map[string]string{"pages/A.json": `{"do_objectID": "A", "name": "A", "layers": []}`})
+	writeTestFiles(t, oursDir, map[string]string{"pages/A.json": `{"do_objectID": "A", "name": "ours A", "layers": []}`})
+	writeTestFiles(t, theirsDir, map[string]string{"pages/A.json": `{"do_objectID": "A", "name": "theirs A", "layers": []}`})
+
+	//directory argument with trailing separator, report goes next to the directory
+	if _, err := ProcessFileMerge3(baseDir, oursDir + string(os.PathSeparator), theirsDir, "", nil); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "ours.conflicts.json")); err != nil {
+		t.Errorf("Expected conflicts report next to ours directory, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(oursDir, ".conflicts.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no report inside of ours directory, got %v", err)
+	}
+}
+
+func TestProcessFileMerge3_Rollback(t *testing.T) {
+	root, err := ioutil.TempDir("", "sketchmerge-merge3")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	baseDir, oursDir, theirsDir := filepath.Join(root, "base"), filepath.Join(root, "ours"), filepath.Join(root, "theirs")
+	base := map[string]string{"document.json": `{"name": "base"}`, "pages/E.json": `{"name": "E"}`}
+	writeTestFiles(t, baseDir, base)
+	writeTestFiles(t, oursDir, base)
+	writeTestFiles(t, theirsDir, map[string]string{"document.json": `{"name": "theirs"}`, "pages/D.json": `{}`, "pages/E.json": `{"name":`})
+
+	if _, err := ProcessFileMerge3(baseDir, oursDir, theirsDir, root, nil); err == nil {
+		t.Fatalf("Expected merge of invalid theirs page to fail")
+	}
+
+	if doc, err := readJSON(filepath.Join(oursDir, "document.json")); err != nil || doc["name"] != "base" {
+		t.Errorf("Expected ours document untouched, got %v %v", doc, err)
+	}
+	if _, err := os.Stat(filepath.Join(oursDir, "pages", "D.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no page added to ours, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package sketchmerge
 import (
 	"fmt"
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -230,3 +231,104 @@ func TestMergeDocuments_MergeByJSONPath1(t *testing.T) {
 	fmt.Println(string(mergeInfo2))
 
 }
+
+func TestMergeDocuments_MergeByObjectIDPath(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1"},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "renamed"},
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"}
+		]}`), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3"},
+			{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2"},
+			{"do_objectID": "2E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test4"}
+		]}`), &jsonDoc2)
+
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	sel, _, err := Parse(`$["layers"][?do_objectID=="FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["name"]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if value, _, err := sel.Apply(jsonDoc2); err != nil || value != "test2" {
+		t.Errorf("Expected test2, got %v %v", value, err)
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+
+	if err := mergeDoc.MergeByJSONPath(`$["layers"][?do_objectID=="FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["name"]`, `$["layers"][?do_objectID=="FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["name"]`); err != nil {
+		t.Errorf("Merge of change failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath(`+$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]`, `$["layers"]`); err != nil {
+		t.Errorf("Merge of add failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath("", `-$["layers"][?do_objectID=="2E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]`); err != nil {
+		t.Errorf("Merge of delete failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath("", `-$["layers"][?do_objectID=="2E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]`); err != NotFound {
+		t.Errorf("Expected NotFound for missing element, got %v", err)
+	}
+
+	layers := mergeDoc.DstDocument["layers"].([]interface{})
+	if len(layers) != 3 {
+		t.Fatalf("Expected 3 layers, got %v", len(layers))
+	}
+
+	if name := layers[2].(map[string]interface{})["name"]; name != "renamed" {
+		t.Errorf("Expected renamed layer, got %v", name)
+	}
+
+	//added layer goes right before its following sibling
+	if id := layers[1].(map[string]interface{})["do_objectID"]; id != "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA" {
+		t.Errorf("Expected added layer, got %v", id)
+	}
+}
+
+func TestMergeDocuments_AddArrayElementPosition(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "A", "name": "bottom"},
+			{"do_objectID": "B", "name": "middle"},
+			{"do_objectID": "C", "name": "new"},
+			{"do_objectID": "D", "name": "top"}
+		], "empty": [{"do_objectID": "E"}], "points": [1, 2, 3]}`), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(`{"layers":[
+			{"do_objectID": "D", "name": "top"},
+			{"do_objectID": "A", "name": "bottom"},
+			{"do_objectID": "B", "name": "middle"},
+			{"do_objectID": "X", "name": "other"}
+		], "empty": [], "points": [1, 2]}`), &jsonDoc2)
+
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+
+	if err := mergeDoc.MergeByJSONPath(`+$["layers"][2]`, `$["layers"]`); err != nil {
+		t.Errorf("Merge of add failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath(`+$["empty"][0]`, `$["empty"]`); err != nil {
+		t.Errorf("Merge of add failed: %v", err)
+	}
+	if err := mergeDoc.MergeByJSONPath(`+$["points"][2]`, `$["points"]`); err != nil {
+		t.Errorf("Merge of add failed: %v", err)
+	}
+
+	ids := objectKeys("do_objectID", mergeDoc.DstDocument["layers"])
+	if !reflect.DeepEqual(ids, []interface{}{"D", "A", "B", "C", "X"}) {
+		t.Errorf("Expected added layer after its preceding sibling, got %v", ids)
+	}
+
+	if empty := mergeDoc.DstDocument["empty"].([]interface{}); len(empty) != 1 {
+		t.Errorf("Expected added element in empty array, got %v", empty)
+	}
+
+	if points := mergeDoc.DstDocument["points"]; !reflect.DeepEqual(points, []interface{}{1.0, 2.0, 3.0}) {
+		t.Errorf("Expected appended point, got %v", points)
+	}
+}
@@ -0,0 +1,275 @@
+package sketchmerge
+
+import (
+	"sort"
+)
+
+//Replaces pairs of add and delete differences of the same object by move differences
+//Object only in doc1 at one path and only in doc2 at another path is relocated, not recreated
+func (jsc * JsonStructureCompare) detectMoves(doc1 map[string]interface{}, doc2 map[string]interface{}) {
+	adds := make(map[string]string)
+	deletes := make(map[string]string)
+
+	for key := range jsc.Doc1Diffs {
+		switch {
+		case isDeleteDiff(key):
+			if id, ok := jsc.movedObjectID(doc2, key); ok {
+				deletes[id] = key[1:]
+			}
+		case isAddDiff(key):
+			if id, ok := jsc.movedObjectID(doc1, key); ok {
+				adds[id] = key[1:]
+			}
+		}
+	}
+
+	jsc.addMoves(adds, deletes)
+}
+
+//Gets object key value of array element selected by diff path
+func (jsc * JsonStructureCompare) movedObjectID(doc map[string]interface{}, key string) (string, bool) {
+	path, err := ParsePath(key)
+	if err != nil {
+		return "", false
+	}
+
+	switch path.Last().(type) {
+	case *ArraySelection, *ObjectIDSelection:
+	default:
+		return "", false
+	}
+
+	value, err := path.Resolve(doc)
+	if err != nil {
+		return "", false
+	}
+
+	valueMap, _ := value.(map[string]interface{})
+	id, ok := valueMap[jsc.ObjectKeyName].(string)
+	return id, ok
+}
+
+//Turns pairs of added and deleted objects with the same object key value into relocations and move differences
+func (jsc * JsonStructureCompare) addMoves(adds map[string]string, deletes map[string]string) {
+	ids := make([]string, 0, len(adds))
+	for id := range adds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		srcPath := adds[id]
+		dstPath, ok := deletes[id]
+		if !ok {
+			continue
+		}
+
+		jsc.addDoc1ObjectRelocated(id, srcPath, "detectMoves")
+		jsc.addDoc2ObjectRelocated(id, dstPath, "detectMoves")
+
+		if jsc.moveParents == nil {
+			jsc.moveParents = make(map[string]string)
+		}
+		jsc.moveParents[srcPath] = toString(jsc.Doc1Diffs["+" + srcPath])
+
+		delete(jsc.Doc1Diffs, "+" + srcPath)
+		delete(jsc.Doc1Diffs, "-" + dstPath)
+		delete(jsc.Doc2Diffs, "-" + srcPath)
+		delete(jsc.Doc2Diffs, "+" + dstPath)
+
+		jsc.Doc1MoveDiffs[srcPath] = dstPath
+		jsc.Doc2MoveDiffs[dstPath] = srcPath
+	}
+}
+
+//Gets path of the first object with given object key value, maps are searched by sorted keys
+func findObjectPath(v interface{}, path Path, objectKeyName string, objectKeyValue string) (Path, bool) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if value[objectKeyName] == objectKeyValue {
+			return path, true
+		}
+		for _, key := range sortedKeys(value) {
+			if found, ok := findObjectPath(value[key], path.Key(key), objectKeyName, objectKeyValue); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		for index, item := range value {
+			if found, ok := findObjectPath(item, path.Index(index), objectKeyName, objectKeyValue); ok {
+				return found, true
+			}
+		}
+	}
+	return Path{}, false
+}
+
+//Gets path in dst of the container of src path
+//Container is anchored on its nearest ancestor with object key, so it's found wherever the ancestor is in dst
+func (md * MergeDocuments) targetContainer(objectKeyName string, srcContainer Path) Path {
+	for i := srcContainer.Len(); i > 0; i-- {
+		anchor := Path{srcContainer.segments[:i:i], ValueChange}
+		value, err := anchor.Resolve(md.SrcDocument)
+		if err != nil {
+			continue
+		}
+
+		valueMap, _ := value.(map[string]interface{})
+		id, ok := valueMap[objectKeyName].(string)
+		if !ok {
+			continue
+		}
+
+		found, ok := findObjectPath(md.DstDocument, NewPath(), objectKeyName, id)
+		if !ok {
+			break
+		}
+		for _, segment := range srcContainer.segments[i:] {
+			found = found.Append(segment)
+		}
+		return found
+	}
+	return srcContainer
+}
+
+//Moves object from dstPath of dst document to the container and position it has at srcPath of src document
+//The object keeps its identity, differences of its content are merged from src object
+func (md * MergeDocuments) MoveByJSONPath(objectKeyName string, srcPath string, dstPath string) error {
+	srcSel, srcMap, err := md.movedSrcObject(objectKeyName, srcPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := md.targetContainer(objectKeyName, srcSel.Parent()).Resolve(md.DstDocument); err != nil {
+		return err
+	}
+
+	dst, err := md.takeObject(objectKeyName, srcMap[objectKeyName].(string), dstPath)
+	if err != nil {
+		return err
+	}
+
+	return md.placeObject(objectKeyName, srcSel, srcMap, dst)
+}
+
+//Gets object of src document selected by srcPath
+func (md * MergeDocuments) movedSrcObject(objectKeyName string, srcPath string) (Path, map[string]interface{}, error) {
+	srcSel, err := ParsePath(srcPath)
+	if err != nil {
+		return Path{}, nil, err
+	}
+
+	if srcSel.IsRoot() {
+		return Path{}, nil, NotFound
+	}
+
+	src, err := srcSel.Resolve(md.SrcDocument)
+	if err != nil {
+		return Path{}, nil, err
+	}
+
+	srcMap, ok := src.(map[string]interface{})
+	if !ok {
+		return Path{}, nil, MapTypeError
+	}
+
+	if _, ok := srcMap[objectKeyName].(string); !ok {
+		return Path{}, nil, NotFound
+	}
+	return srcSel, srcMap, nil
+}
+
+//Removes object with given object key value from dst document and gets it
+//Object is looked up by its key when indices of dst path were shifted by other changes
+func (md * MergeDocuments) takeObject(objectKeyName string, id string, dstPath string) (interface{}, error) {
+	dstSel, err := ParsePath(dstPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := dstSel.Resolve(md.DstDocument)
+	if dstMap, isMap := dst.(map[string]interface{}); err != nil || !isMap || dstMap[objectKeyName] != id {
+		var ok bool
+		if dstSel, ok = findObjectPath(md.DstDocument, NewPath(), objectKeyName, id); !ok {
+			return nil, NotFound
+		}
+		dst, _ = dstSel.Resolve(md.DstDocument)
+	}
+
+	if err := md.deleteArrayElement(dstSel); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+//Merges differences of src object into dst object and inserts it into dst container of srcPath
+func (md * MergeDocuments) placeObject(objectKeyName string, srcSel Path, srcObject interface{}, dstObject interface{}) error {
+	moved, err := mergeObject(objectKeyName, srcObject, dstObject)
+	if err != nil {
+		return err
+	}
+
+	target := md.targetContainer(objectKeyName, srcSel.Parent())
+	if target.IsRoot() {
+		return ArrayTypeError
+	}
+
+	container, err := target.Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
+
+	targetArr, ok := container.([]interface{})
+	if !ok {
+		return ArrayTypeError
+	}
+
+	forTarget, err := target.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
+
+	index := md.insertIndex(srcSel, targetArr)
+
+	finArr := make([]interface{}, 0, len(targetArr) + 1)
+	finArr = append(finArr, targetArr[:index]...)
+	finArr = append(finArr, moved)
+	finArr = append(finArr, targetArr[index:]...)
+
+	return replaceChild(forTarget, target.Last(), finArr)
+}
+
+//Merges differences of src object into dst object
+func mergeObject(objectKeyName string, src interface{}, dst interface{}) (interface{}, error) {
+	srcDoc := map[string]interface{}{"object": src}
+	dstDoc := map[string]interface{}{"object": dst}
+
+	jsc := NewJsonStructureCompare()
+	jsc.ObjectKeyName = objectKeyName
+	jsc.Compare(srcDoc, dstDoc, "$")
+
+	mergeDoc := MergeDocuments{srcDoc, dstDoc}
+	for _, err := range mergeDoc.ApplyPlan(PlanMerge(jsc)) {
+		if err != nil && err != NotFound {
+			return nil, err
+		}
+	}
+	return mergeDoc.DstDocument["object"], nil
+}
+
+//Gets src to dst differences with moves given back as deletes and adds
+func (jsc * JsonStructureCompare) diffsWithoutMoves() map[string]interface{} {
+	if len(jsc.Doc1MoveDiffs) == 0 {
+		return jsc.Doc1Diffs
+	}
+
+	diffs := make(map[string]interface{}, len(jsc.Doc1Diffs) + 2 * len(jsc.Doc1MoveDiffs))
+	for key, item := range jsc.Doc1Diffs {
+		diffs[key] = item
+	}
+	for srcPath, dstPath := range jsc.Doc1MoveDiffs {
+		diffs["+" + srcPath] = jsc.moveParents[srcPath]
+		diffs["-" + toString(dstPath)] = ""
+	}
+	return diffs
+}
@@ -0,0 +1,116 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const moveTestDoc1 = `{"layers": [
+	{"do_objectID": "G1", "layers": [
+		{"do_objectID": "A", "name": "stays"},
+		{"do_objectID": "L", "name": "renamed", "frame": {"x": 10}}
+	]},
+	{"do_objectID": "G2", "layers": [{"do_objectID": "B", "name": "other"}]}
+]}`
+
+const moveTestDoc2 = `{"layers": [
+	{"do_objectID": "G1", "layers": [{"do_objectID": "A", "name": "stays"}]},
+	{"do_objectID": "G2", "layers": [
+		{"do_objectID": "L", "name": "moved", "frame": {"x": 10}},
+		{"do_objectID": "B", "name": "other"}
+	]}
+]}`
+
+func TestJsonStructureCompare_DetectMoves(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(moveTestDoc1), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(moveTestDoc2), &jsonDoc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.DetectMoves = true
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	expected := map[string]interface{}{`$["layers"][0]["layers"][1]`: `$["layers"][1]["layers"][0]`}
+	if !reflect.DeepEqual(jsCompare.Doc1MoveDiffs, expected) {
+		t.Errorf("Expected move %v, got %v", expected, jsCompare.Doc1MoveDiffs)
+	}
+
+	if jsCompare.Doc2MoveDiffs[`$["layers"][1]["layers"][0]`] != `$["layers"][0]["layers"][1]` {
+		t.Errorf("Expected reverse move, got %v", jsCompare.Doc2MoveDiffs)
+	}
+
+	for key := range jsCompare.Doc1Diffs {
+		if key[0] == '+' || key[0] == '-' {
+			t.Errorf("Moved object should not be added or deleted %v", key)
+		}
+	}
+
+	if jsCompare.Doc1ObjRelocate["L"] != `$["layers"][0]["layers"][1]` || jsCompare.Doc2ObjRelocate["L"] != `$["layers"][1]["layers"][0]` {
+		t.Errorf("Expected relocation of moved object %v %v", jsCompare.Doc1ObjRelocate, jsCompare.Doc2ObjRelocate)
+	}
+
+	patch, err := jsCompare.JSONPatch(jsonDoc1, jsonDoc2)
+	if err != nil {
+		t.Fatalf("JSONPatch failed: %v", err)
+	}
+	patchDoc := MergeDocuments{nil, jsonDoc2}
+	if err := patchDoc.ApplyPatch(patch); err != nil || !reflect.DeepEqual(patchDoc.DstDocument, jsonDoc1) {
+		t.Errorf("Expected patch with moves turning doc2 into doc1 %v", err)
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+	moved := jsonDoc2["layers"].([]interface{})[1].(map[string]interface{})["layers"].([]interface{})[0].(map[string]interface{})
+
+	for i, err := range mergeDoc.ApplyPlan(PlanMerge(jsCompare)) {
+		if err != nil {
+			t.Errorf("Step %v failed: %v", i, err)
+		}
+	}
+
+	if !reflect.DeepEqual(mergeDoc.DstDocument, jsonDoc1) {
+		data, _ := json.Marshal(mergeDoc.DstDocument)
+		t.Errorf("Expected merged document equal to src, got %s", data)
+	}
+
+	//moved object is relocated, not recreated
+	group := mergeDoc.DstDocument["layers"].([]interface{})[0].(map[string]interface{})
+	if reflect.ValueOf(group["layers"].([]interface{})[1]).Pointer() != reflect.ValueOf(moved).Pointer() {
+		t.Errorf("Expected the same object moved")
+	}
+}
+
+func TestMergeDocuments_MoveByJSONPath(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(moveTestDoc1), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(moveTestDoc2), &jsonDoc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+
+	//stale index of dst path, the object is found by its key
+	if err := mergeDoc.MoveByJSONPath("do_objectID", `$["layers"][0]["layers"][1]`, `$["layers"][1]["layers"][1]`); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+
+	groups := mergeDoc.DstDocument["layers"].([]interface{})
+	if ids := objectKeys("do_objectID", groups[0].(map[string]interface{})["layers"]); !reflect.DeepEqual(ids, []interface{}{"A", "L"}) {
+		t.Errorf("Expected object moved after its sibling, got %v", ids)
+	}
+	if ids := objectKeys("do_objectID", groups[1].(map[string]interface{})["layers"]); !reflect.DeepEqual(ids, []interface{}{"B"}) {
+		t.Errorf("Expected object removed from old group, got %v", ids)
+	}
+
+	if err := mergeDoc.MoveByJSONPath("do_objectID", `$["layers"][0]["layers"][1]`, `$["layers"][1]["layers"][0]`); err != nil {
+		t.Errorf("Repeated move should find the object in place: %v", err)
+	}
+
+	if err := mergeDoc.MoveByJSONPath("do_objectID", `$["layers"][0]["layers"][5]`, `$["layers"][1]["layers"][0]`); err != IndexOutOfBounds {
+		t.Errorf("Expected IndexOutOfBounds for missing src object, got %v", err)
+	}
+}
@@ -0,0 +1,466 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"github.com/mohae/deepcopy"
+)
+
+//RFC 6902 JSON Patch operations
+const (
+	PatchAdd = "add"
+	PatchRemove = "remove"
+	PatchReplace = "replace"
+	PatchMove = "move"
+	PatchCopy = "copy"
+	PatchTest = "test"
+)
+
+var (
+	UnknownPatchOperation = errors.New("Unknown patch operation.")
+	PatchTestFailed = errors.New("Patch test operation failed.")
+)
+
+//Single operation of RFC 6902 JSON Patch, paths are JSON Pointers
+type PatchOperation struct {
+	Op string `json:"op"`
+	From string `json:"from,omitempty"`
+	Path string `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+//Writes value member only for operations having it, so null values are kept
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	switch op.Op {
+	case PatchAdd, PatchReplace, PatchTest:
+		return json.Marshal(struct {
+			Op string `json:"op"`
+			Path string `json:"path"`
+			Value interface{} `json:"value"`
+		}{op.Op, op.Path, op.Value})
+	case PatchMove, PatchCopy:
+		return json.Marshal(struct {
+			Op string `json:"op"`
+			From string `json:"from"`
+			Path string `json:"path"`
+		}{op.Op, op.From, op.Path})
+	}
+	return json.Marshal(struct {
+		Op string `json:"op"`
+		Path string `json:"path"`
+	}{op.Op, op.Path})
+}
+
+//Converts differences into JSON Patch turning doc2 into doc1
+//Steps of the merge plan are replayed on a copy of doc2, so the patch places and orders array elements the way merge does
+//Values are taken from doc1, array elements addressed by object key are resolved to indices of the patched document
+func (jsc * JsonStructureCompare) JSONPatch(doc1 map[string]interface{}, doc2 map[string]interface{}) ([]PatchOperation, error) {
+	patch := make([]PatchOperation, 0)
+	//operations are applied to the copy of doc2 to address nodes the way the patch will see them
+	working := MergeDocuments{doc1, deepcopy.Copy(doc2).(map[string]interface{})}
+
+	emit := func(op PatchOperation) error {
+		if err := working.applyPatchOperation(op); err != nil {
+			return err
+		}
+		patch = append(patch, op)
+		return nil
+	}
+
+	//moved objects are removed and added by the patch
+	withoutMoves := *jsc
+	withoutMoves.Doc1Diffs = jsc.diffsWithoutMoves()
+	withoutMoves.Doc1MoveDiffs = nil
+	plan := PlanMerge(&withoutMoves)
+
+	for _, step := range plan.Steps {
+		var err error
+		switch step.Action {
+		case ValueChange:
+			err = working.changePatch(step, emit)
+		case ValueDelete:
+			err = working.deletePatch(step, emit)
+		case ValueAdd:
+			var op PatchOperation
+			if op, err = working.addPatch(plan, step, emit); err == nil && op.Op != "" {
+				patch = append(patch, op)
+			}
+		case SequenceChange:
+			err = working.sequencePatch(plan, step, emit)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return patch, nil
+}
+
+//Emits replace operation of change step
+func (md * MergeDocuments) changePatch(step MergeStep, emit func(PatchOperation) error) error {
+	value, err := patchValue(md.SrcDocument, step.SrcPath)
+	if err != nil {
+		return err
+	}
+	pointer, err := concretePointer(md.DstDocument, step.DstPath)
+	if err != nil {
+		return err
+	}
+	return emit(PatchOperation{Op: PatchReplace, Path: pointer, Value: value})
+}
+
+//Emits remove operation of delete step
+func (md * MergeDocuments) deletePatch(step MergeStep, emit func(PatchOperation) error) error {
+	pointer, err := concretePointer(md.DstDocument, step.DstPath)
+	if err != nil {
+		return err
+	}
+	return emit(PatchOperation{Op: PatchRemove, Path: pointer})
+}
+
+//Emits add operation of map key, array elements are added the way merge does and their add operation is given back
+//Array element goes to the index merge inserted it at
+func (md * MergeDocuments) addPatch(plan MergePlan, step MergeStep, emit func(PatchOperation) error) (PatchOperation, error) {
+	pointer, err := concretePointer(md.DstDocument, step.DstPath)
+	if err != nil {
+		return PatchOperation{}, err
+	}
+
+	srcPath, err := ParsePath(step.SrcPath)
+	if err != nil {
+		return PatchOperation{}, err
+	}
+	if key, isMapKey := srcPath.Last().(*MapSelection); isMapKey {
+		value, err := patchValue(md.SrcDocument, step.SrcPath)
+		if err != nil {
+			return PatchOperation{}, err
+		}
+		return PatchOperation{}, emit(PatchOperation{Op: PatchAdd, Path: pointer + PointerSegment(key.Key), Value: value})
+	}
+
+	before, err := md.getPointer(pointer)
+	if err != nil {
+		return PatchOperation{}, err
+	}
+	beforeArr, ok := before.([]interface{})
+	if !ok {
+		return PatchOperation{}, ArrayTypeError
+	}
+
+	if err := md.applyPlanStep(plan, step); err != nil {
+		return PatchOperation{}, err
+	}
+
+	after, err := md.getPointer(pointer)
+	if err != nil {
+		return PatchOperation{}, err
+	}
+	afterArr, ok := after.([]interface{})
+	if !ok || len(afterArr) != len(beforeArr) + 1 {
+		return PatchOperation{}, ArrayTypeError
+	}
+
+	//the first element differing from the array before is the inserted one, inserting an equal neighbour gives the same array
+	index := len(beforeArr)
+	for i := range beforeArr {
+		if !reflect.DeepEqual(beforeArr[i], afterArr[i]) {
+			index = i
+			break
+		}
+	}
+	return PatchOperation{Op: PatchAdd, Path: pointer + "/" + strconv.Itoa(index), Value: deepcopy.Copy(afterArr[index])}, nil
+}
+
+//Emits move operations ordering array of dst document as merge does, by identities of elements of array of src document
+func (md * MergeDocuments) sequencePatch(plan MergePlan, step MergeStep, emit func(PatchOperation) error) error {
+	srcPath, err := ParsePath(step.SrcPath)
+	if err != nil {
+		return err
+	}
+	src, err := srcPath.Resolve(md.SrcDocument)
+	if err != nil {
+		return err
+	}
+
+	pointer, err := concretePointer(md.DstDocument, step.DstPath)
+	if err != nil {
+		return err
+	}
+	dst, err := md.getPointer(pointer)
+	if err != nil {
+		return err
+	}
+
+	srcArr, isSrcArr := src.([]interface{})
+	dstArr, isDstArr := dst.([]interface{})
+	if !isSrcArr || !isDstArr {
+		return ArrayTypeError
+	}
+
+	//current holds indices of elements of dst array at their current positions
+	current := make([]int, len(dstArr))
+	for i := range current {
+		current[i] = i
+	}
+
+	for i, index := range sequenceOrder(plan.sequenceIdentity(md.SrcDocument, step.SrcPath), srcArr, dstArr) {
+		j := i
+		for current[j] != index {
+			j++
+		}
+		if j == i {
+			continue
+		}
+
+		op := PatchOperation{Op: PatchMove, From: pointer + "/" + strconv.Itoa(j), Path: pointer + "/" + strconv.Itoa(i)}
+		if err := emit(op); err != nil {
+			return err
+		}
+		copy(current[i + 1:j + 1], current[i:j])
+		current[i] = index
+	}
+	return nil
+}
+
+//Gets copy of value at path of doc
+func patchValue(doc map[string]interface{}, path string) (interface{}, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.Resolve(doc)
+	if err != nil {
+		return nil, err
+	}
+	return deepcopy.Copy(value), nil
+}
+
+//Builds JSON Pointer of the node selected by path in doc, object key selectors are replaced by indices
+func concretePointer(doc map[string]interface{}, path string) (string, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return "", err
+	}
+	if p.IsPattern() {
+		return "", NotPointerPath
+	}
+
+	pointer := ""
+	var v interface{} = doc
+	for i := 0; i < p.Len(); i++ {
+		matches, err := selectChildren(p.Segment(i), v)
+		if err != nil {
+			return "", err
+		}
+		switch key := matches[0].Key.(type) {
+		case int:
+			pointer += "/" + strconv.Itoa(key)
+		case string:
+			pointer += PointerSegment(key)
+		}
+		v = matches[0].Value
+	}
+	return pointer, nil
+}
+
+//Applies JSON Patch to destination document
+//Patch is applied to a copy of the document, DstDocument is replaced only if all operations succeed
+func (md * MergeDocuments) ApplyPatch(patch []PatchOperation) error {
+	working := MergeDocuments{md.SrcDocument, deepcopy.Copy(md.DstDocument).(map[string]interface{})}
+
+	for _, op := range patch {
+		if err := working.applyPatchOperation(op); err != nil {
+			return err
+		}
+	}
+
+	md.DstDocument = working.DstDocument
+	return nil
+}
+
+func (md * MergeDocuments) applyPatchOperation(op PatchOperation) error {
+	switch op.Op {
+	case PatchAdd:
+		return md.addPointer(op.Path, deepcopy.Copy(op.Value))
+	case PatchRemove:
+		_, err := md.removePointer(op.Path)
+		return err
+	case PatchReplace:
+		if _, err := md.getPointer(op.Path); err != nil {
+			return err
+		}
+		if op.Path == "" {
+			return md.replaceRoot(op.Value)
+		}
+		return md.SetByJSONPath(op.Path, deepcopy.Copy(op.Value))
+	case PatchMove:
+		value, err := md.removePointer(op.From)
+		if err != nil {
+			return err
+		}
+		return md.addPointer(op.Path, value)
+	case PatchCopy:
+		value, err := md.getPointer(op.From)
+		if err != nil {
+			return err
+		}
+		return md.addPointer(op.Path, deepcopy.Copy(value))
+	case PatchTest:
+		value, err := md.getPointer(op.Path)
+		if err != nil {
+			return err
+		}
+		if !patchEqual(value, op.Value) {
+			return PatchTestFailed
+		}
+		return nil
+	}
+	return UnknownPatchOperation
+}
+
+func (md * MergeDocuments) replaceRoot(value interface{}) error {
+	root, ok := deepcopy.Copy(value).(map[string]interface{})
+	if !ok {
+		return MapTypeError
+	}
+	md.DstDocument = root
+	return nil
+}
+
+func (md * MergeDocuments) getPointer(pointer string) (interface{}, error) {
+	p, err := ParsePath(pointer)
+	if err != nil {
+		return nil, err
+	}
+	return p.Resolve(md.DstDocument)
+}
+
+//Gets container of the node addressed by pointer and reference token of the node in it
+func (md * MergeDocuments) pointerParent(pointer string) (Path, interface{}, string, error) {
+	if !isPointer(pointer) {
+		return Path{}, nil, "", NotPointerPath
+	}
+
+	p, err := ParsePath(pointer)
+	if err != nil {
+		return p, nil, "", err
+	}
+
+	container, err := p.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return p, nil, "", err
+	}
+
+	switch last := p.Last().(type) {
+	case *ArraySelection:
+		return p, container, last.Token, nil
+	case *MapSelection:
+		return p, container, last.Key, nil
+	}
+	return p, nil, "", SyntaxError
+}
+
+func (md * MergeDocuments) addPointer(pointer string, value interface{}) error {
+	if pointer == "" {
+		return md.replaceRoot(value)
+	}
+
+	p, container, token, err := md.pointerParent(pointer)
+	if err != nil {
+		return err
+	}
+
+	switch parent := container.(type) {
+	case map[string]interface{}:
+		parent[token] = value
+		return nil
+	case []interface{}:
+		index := len(parent)
+		if token != "-" {
+			var ok bool
+			if index, ok = pointerIndex(token); !ok || index > len(parent) {
+				return IndexOutOfBounds
+			}
+		}
+		arr := make([]interface{}, 0, len(parent) + 1)
+		arr = append(append(append(arr, parent[:index]...), value), parent[index:]...)
+		return md.replaceContainer(p.Parent(), arr)
+	}
+	return MapTypeError
+}
+
+func (md * MergeDocuments) removePointer(pointer string) (interface{}, error) {
+	p, container, token, err := md.pointerParent(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parent := container.(type) {
+	case map[string]interface{}:
+		value, ok := parent[token]
+		if !ok {
+			return nil, NotFound
+		}
+		delete(parent, token)
+		return value, nil
+	case []interface{}:
+		index, ok := pointerIndex(token)
+		if !ok || index >= len(parent) {
+			return nil, IndexOutOfBounds
+		}
+		value := parent[index]
+		arr := make([]interface{}, 0, len(parent) - 1)
+		arr = append(append(arr, parent[:index]...), parent[index+1:]...)
+		return value, md.replaceContainer(p.Parent(), arr)
+	}
+	return nil, MapTypeError
+}
+
+//Replaces array at path, arrays can't be changed in place when their length changes
+func (md * MergeDocuments) replaceContainer(p Path, value interface{}) error {
+	if p.IsRoot() {
+		return MapTypeError
+	}
+
+	container, err := p.Parent().Resolve(md.DstDocument)
+	if err != nil {
+		return err
+	}
+	return replaceChild(container, p.Last(), value)
+}
+
+//Compares json values, numbers are compared by value
+func patchEqual(v1 interface{}, v2 interface{}) bool {
+	if num1, ok := toFloat(v1); ok {
+		num2, ok := toFloat(v2)
+		return ok && num1 == num2
+	}
+
+	switch value1 := v1.(type) {
+	case map[string]interface{}:
+		value2, ok := v2.(map[string]interface{})
+		if !ok || len(value1) != len(value2) {
+			return false
+		}
+		for key, item := range value1 {
+			if !patchEqual(item, value2[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		value2, ok := v2.([]interface{})
+		if !ok || len(value1) != len(value2) {
+			return false
+		}
+		for i := range value1 {
+			if !patchEqual(value1[i], value2[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(v1, v2)
+}
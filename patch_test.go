@@ -0,0 +1,171 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestJsonStructureCompare_JSONPatch(t *testing.T) {
+	doc1JSON := `{"name": "page", "layers":[
+			{"do_objectID": "3", "name": "test3", "points": [1, 2, 5]},
+			{"do_objectID": "1", "name": "renamed", "style": {"opacity": 0.5}},
+			{"do_objectID": "4", "name": "new"},
+			{"do_objectID": "2", "name": "test2", "isVisible": null}
+		], "a/b": {"~": true}}`
+	doc2JSON := `{"name": "page", "layers":[
+			{"do_objectID": "1", "name": "test1", "style": {"opacity": 1, "blur": 0}},
+			{"do_objectID": "2", "name": "test2", "isVisible": true},
+			{"do_objectID": "5", "name": "deleted"},
+			{"do_objectID": "3", "name": "test3", "points": [1, 3]}
+		], "removed": 1}`
+
+	for _, idPaths := range []bool{false, true} {
+		var doc1, doc2, expected map[string]interface{}
+		err1 := json.Unmarshal([]byte(doc1JSON), &doc1)
+		err2 := json.Unmarshal([]byte(doc2JSON), &doc2)
+		err3 := json.Unmarshal([]byte(doc1JSON), &expected)
+		if err1 != nil || err2 != nil || err3 != nil {
+			t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+		}
+
+		jsCompare := NewJsonStructureCompare()
+		jsCompare.Options.ObjectIDPaths = idPaths
+		jsCompare.Compare(doc1, doc2, "$")
+
+		patch, err := jsCompare.JSONPatch(doc1, doc2)
+		if err != nil {
+			t.Fatalf("Patch export failed: %v", err)
+		}
+
+		data, err := json.Marshal(patch)
+		if err != nil {
+			t.Fatalf("Patch marshal failed: %v", err)
+		}
+
+		var decoded []PatchOperation
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Patch unmarshal failed: %v", err)
+		}
+
+		mergeDoc := MergeDocuments{nil, doc2}
+		if err := mergeDoc.ApplyPatch(decoded); err != nil {
+			t.Fatalf("Patch apply failed: %v\n%s", err, data)
+		}
+
+		if !reflect.DeepEqual(mergeDoc.DstDocument, expected) {
+			t.Errorf("Patched document differs from source, id paths %v:\n%v\n%s", idPaths, mergeDoc.DstDocument, data)
+		}
+	}
+}
+
+func TestJsonStructureCompare_JSONPatchRoundTrip(t *testing.T) {
+	pairs := [][2]string{
+		//nested add, delete and reorder
+		{`{"layers": [{"do_objectID": "A", "layers": [{"do_objectID": "A2"}, {"do_objectID": "A1", "name": "a"}]}, {"do_objectID": "C"}]}`,
+			`{"layers": [{"do_objectID": "X"}, {"do_objectID": "C"}, {"do_objectID": "A", "layers": [{"do_objectID": "A1"}, {"do_objectID": "A3"}]}]}`},
+		//override values are ordered by their override names
+		{`{"layers": [{"do_objectID": "S", "_class": "symbolInstance", "overrideValues": [{"overrideName": "c"}, {"overrideName": "a"}, {"overrideName": "b"}]}]}`,
+			`{"layers": [{"do_objectID": "S", "_class": "symbolInstance", "overrideValues": [{"overrideName": "a"}, {"overrideName": "b"}, {"overrideName": "c"}]}]}`},
+		//added point of curve keeps its index
+		{`{"points": [{"x": 1}, {"x": 2}, {"x": 3}]}`, `{"points": [{"x": 1}, {"x": 3}]}`},
+		{`{"points": [1, 2, 3]}`, `{"points": [1, 3]}`},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		src := map[string]interface{}{"layers": randomLayers(random, make(map[string]bool), 2)}
+		dst := map[string]interface{}{"layers": randomLayers(random, make(map[string]bool), 2)}
+		srcData, _ := json.Marshal(src)
+		dstData, _ := json.Marshal(dst)
+		pairs = append(pairs, [2]string{string(srcData), string(dstData)})
+	}
+
+	for _, options := range []CompareOptions{{}, {DetectMoves: true}, {LCSMatching: true}, {ObjectIDPaths: true}} {
+		for _, pair := range pairs {
+			var doc1, doc2, expected map[string]interface{}
+			err1 := json.Unmarshal([]byte(pair[0]), &doc1)
+			err2 := json.Unmarshal([]byte(pair[1]), &doc2)
+			err3 := json.Unmarshal([]byte(pair[0]), &expected)
+			if err1 != nil || err2 != nil || err3 != nil {
+				t.Fatalf("Error occured %v %v %v", err1, err2, err3)
+			}
+
+			jsCompare := NewJsonStructureCompare()
+			jsCompare.Options = options
+			jsCompare.Compare(doc1, doc2, "$")
+
+			patch, err := jsCompare.JSONPatch(doc1, doc2)
+			if err != nil {
+				t.Fatalf("Patch export of %v into %v failed: %v", pair[0], pair[1], err)
+			}
+
+			mergeDoc := MergeDocuments{nil, doc2}
+			if err := mergeDoc.ApplyPatch(patch); err != nil {
+				t.Fatalf("Patch apply of %v into %v failed: %v", pair[0], pair[1], err)
+			}
+
+			if !reflect.DeepEqual(mergeDoc.DstDocument, expected) || !reflect.DeepEqual(doc1, expected) {
+				data, _ := json.Marshal(patch)
+				t.Fatalf("Patched document differs from %v, options %+v:\n%v\n%s", pair[0], options, mergeDoc.DstDocument, data)
+			}
+		}
+	}
+}
+
+func TestPatchOperation_MarshalJSON(t *testing.T) {
+	patch := []PatchOperation{
+		{Op: PatchReplace, Path: "/a", Value: nil},
+		{Op: PatchRemove, Path: "/b"},
+		{Op: PatchMove, From: "/c/0", Path: "/c/1"},
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	expected := `[{"op":"replace","path":"/a","value":null},{"op":"remove","path":"/b"},{"op":"move","from":"/c/0","path":"/c/1"}]`
+	if string(data) != expected {
+		t.Errorf("Expected %v, got %s", expected, data)
+	}
+}
+
+func TestMergeDocuments_ApplyPatch(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"layers": [{"name": "a"}, {"name": "b"}], "overrides": {"0": "zero"}}`), &doc); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	mergeDoc := MergeDocuments{nil, doc}
+	err := mergeDoc.ApplyPatch([]PatchOperation{
+		{Op: PatchAdd, Path: "/layers/1", Value: map[string]interface{}{"name": "c"}},
+		{Op: PatchCopy, From: "/layers/0", Path: "/layers/-"},
+		{Op: PatchReplace, Path: "/overrides/0", Value: "one"},
+		{Op: PatchTest, Path: "/layers/2/name", Value: "b"},
+	})
+	if err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+
+	names := make([]interface{}, 0)
+	for _, layer := range mergeDoc.DstDocument["layers"].([]interface{}) {
+		names = append(names, layer.(map[string]interface{})["name"])
+	}
+	if !reflect.DeepEqual(names, []interface{}{"a", "c", "b", "a"}) || mergeDoc.DstDocument["overrides"].(map[string]interface{})["0"] != "one" {
+		t.Errorf("Unexpected patched document %v", mergeDoc.DstDocument)
+	}
+
+	patched := mergeDoc.DstDocument
+	err = mergeDoc.ApplyPatch([]PatchOperation{
+		{Op: PatchRemove, Path: "/layers/0"},
+		{Op: PatchTest, Path: "/layers/0/name", Value: "x"},
+	})
+	if err != PatchTestFailed {
+		t.Errorf("Expected failed test, got %v", err)
+	}
+	if len(mergeDoc.DstDocument["layers"].([]interface{})) != 4 || !reflect.DeepEqual(mergeDoc.DstDocument, patched) {
+		t.Errorf("Failed patch must not change document %v", mergeDoc.DstDocument)
+	}
+}
@@ -0,0 +1,265 @@
+package sketchmerge
+
+import (
+	"strconv"
+	"strings"
+)
+
+//Immutable parsed jsonpath
+//Path never changes its segments, so it can be cached and shared across goroutines
+type Path struct {
+	segments []Node
+	action ApplyAction
+}
+
+//Parses jsonpath into immutable path
+func ParsePath(s string) (Path, error) {
+	sel, action, err := Parse(s)
+	if err != nil {
+		return Path{}, err
+	}
+
+	segments := make([]Node, 0)
+	for node := sel.GetNext(); node != nil; node = node.GetNext() {
+		segments = append(segments, node)
+	}
+
+	return Path{segments, action}, nil
+}
+
+//Gets action prefix of the path
+func (p Path) Action() ApplyAction {
+	return p.action
+}
+
+//Checks whether path selects document root
+func (p Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+//Gets number of segments of the path
+func (p Path) Len() int {
+	return len(p.segments)
+}
+
+//Gets segment at index
+func (p Path) Segment(index int) Node {
+	return p.segments[index]
+}
+
+//Gets path of the parent node, parent of root is root
+func (p Path) Parent() Path {
+	if p.IsRoot() {
+		return p
+	}
+	n := len(p.segments) - 1
+	//limit capacity so appending to parent never overwrites segments of this path
+	return Path{p.segments[:n:n], ValueChange}
+}
+
+//Gets the last segment of the path or nil for root
+func (p Path) Last() Node {
+	if p.IsRoot() {
+		return nil
+	}
+	return p.segments[len(p.segments)-1]
+}
+
+//Builds new path with the segment appended
+func (p Path) Append(segment Node) Path {
+	segments := make([]Node, len(p.segments), len(p.segments) + 1)
+	copy(segments, p.segments)
+	return Path{append(segments, segment), p.action}
+}
+
+//Builds new path with given action prefix
+func (p Path) WithAction(action ApplyAction) Path {
+	return Path{p.segments, action}
+}
+
+//Builds jsonpath string of the path
+func (p Path) String() string {
+	return Serialize(p)
+}
+
+//Builds path of the document root, start point of the path builder
+func NewPath() Path {
+	return Path{make([]Node, 0), ValueChange}
+}
+
+//Builds path of the node chain returned by Parse
+func NodePath(sel Node) Path {
+	segments := make([]Node, 0)
+	for node := sel.GetNext(); node != nil; node = node.GetNext() {
+		segments = append(segments, node)
+	}
+	return Path{segments, ValueChange}
+}
+
+//Builds new path selecting property of map
+func (p Path) Key(key string) Path {
+	return p.Append(&MapSelection{Key: key})
+}
+
+//Builds new path selecting element of array by index
+func (p Path) Index(index int) Path {
+	return p.Append(&ArraySelection{Key: index})
+}
+
+//Builds new path selecting element of array by value of its object key
+func (p Path) ObjectID(objectKeyName string, objectKeyValue string) Path {
+	return p.Append(&ObjectIDSelection{KeyName: objectKeyName, Value: objectKeyValue})
+}
+
+//Builds canonical jsonpath string of the path, Parse(Serialize(p)) gives the same path
+func Serialize(p Path) string {
+	s := "$"
+	switch p.action {
+	case ValueAdd:
+		s = "+$"
+	case ValueDelete:
+		s = "-$"
+	}
+
+	for _, segment := range p.segments {
+		s += segmentString(segment)
+	}
+	return s
+}
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+//Escapes backslashes and quotes of key for quoted jsonpath segment
+func escapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+//Reverts escapeKey
+func unescapeKey(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+
+	key := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i + 1 < len(s) {
+			i++
+		}
+		key = append(key, s[i])
+	}
+	return string(key)
+}
+
+//Gets index of closing quote of quoted string starting at s[0]
+func quoteEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case s[0]:
+			return i
+		}
+	}
+	return -1
+}
+
+//Builds jsonpath segment selecting property of map
+func KeySegment(key string) string {
+	return `["` + escapeKey(key) + `"]`
+}
+
+//Builds jsonpath segment selecting element of array
+func IndexSegment(index int) string {
+	return "[" + strconv.Itoa(index) + "]"
+}
+
+//Gets value of the first node matching the path without changing the path
+func (p Path) Resolve(doc interface{}) (interface{}, error) {
+	return p.resolveFrom(0, doc)
+}
+
+func (p Path) resolveFrom(index int, v interface{}) (interface{}, error) {
+	if index == len(p.segments) {
+		return v, nil
+	}
+
+	matches, err := selectChildren(p.segments[index], v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = NotFound
+	for _, match := range matches {
+		value, matchErr := p.resolveFrom(index + 1, match.Value)
+		if matchErr == nil {
+			return value, nil
+		}
+		err = matchErr
+	}
+	return nil, err
+}
+
+//Checks whether path may select several nodes
+func (p Path) IsPattern() bool {
+	for _, segment := range p.segments {
+		switch segment.(type) {
+		case *WildcardSelection, *SliceSelection, *RecursiveSelection, *FilterSelection:
+			return true
+		}
+	}
+	return false
+}
+
+//Builds jsonpath string of single segment
+func segmentString(segment Node) string {
+	switch sel := segment.(type) {
+	case *MapSelection:
+		return KeySegment(sel.Key)
+	case *ArraySelection:
+		return IndexSegment(sel.Key)
+	case *ObjectIDSelection:
+		return ObjectIDPath("", sel.KeyName, sel.Value)
+	case *WildcardSelection:
+		return "[*]"
+	case *SliceSelection:
+		s := "["
+		if sel.HasStart {
+			s += strconv.Itoa(sel.Start)
+		}
+		s += ":"
+		if sel.HasEnd {
+			s += strconv.Itoa(sel.End)
+		}
+		return s + "]"
+	case *RecursiveSelection:
+		return ".." + KeySegment(sel.Key)
+	case *FilterSelection:
+		return "[?(" + sel.Expression + ")]"
+	}
+	return ""
+}
+
+//Replaces child of map or array container selected by segment
+func replaceChild(container interface{}, segment Node, value interface{}) error {
+	if key, isMapKey := mapKey(segment, container); isMapKey {
+		containerMap, ok := container.(map[string]interface{})
+		if !ok {
+			return MapTypeError
+		}
+		containerMap[key] = value
+		return nil
+	}
+
+	containerArr, ok := container.([]interface{})
+	if !ok {
+		return ArrayTypeError
+	}
+
+	index, err := arrayIndex(segment, containerArr)
+	if err != nil {
+		return err
+	}
+
+	containerArr[index] = value
+	return nil
+}
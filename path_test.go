@@ -0,0 +1,149 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	path, err := ParsePath(`$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["frame"]["x"]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	parent := path.Parent()
+	if parent.String() != `$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["frame"]` {
+		t.Errorf("Unexpected parent %v", parent)
+	}
+
+	if last, ok := path.Last().(*MapSelection); !ok || last.Key != "x" {
+		t.Errorf("Unexpected last segment %v", path.Last())
+	}
+
+	sibling := parent.Append(&MapSelection{Key: "y"})
+	if sibling.String() != `$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["frame"]["y"]` {
+		t.Errorf("Unexpected appended path %v", sibling)
+	}
+
+	if path.String() != `$["layers"][?do_objectID=="BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA"]["frame"]["x"]` {
+		t.Errorf("Path changed after Append %v", path)
+	}
+
+	root, _ := ParsePath("$")
+	if !root.IsRoot() || root.Parent().String() != "$" || root.Last() != nil {
+		t.Errorf("Unexpected root path %v", root)
+	}
+
+	deletePath, _ := ParsePath(`-$["layers"][1:-1]`)
+	if deletePath.String() != `-$["layers"][1:-1]` || deletePath.Parent().String() != `$["layers"]` {
+		t.Errorf("Unexpected delete path %v %v", deletePath, deletePath.Parent())
+	}
+}
+
+func TestPath_Resolve(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(selectionTestDoc), &doc); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	path, err := ParsePath(`$["layers"][*]["style"]["fills"][0]["color"]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := path.Resolve(doc); err != nil || value != "red" {
+				t.Errorf("Expected red, got %v %v", value, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := path.Parent().Append(&MapSelection{Key: "missing"}).Resolve(doc); err != NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+func TestMergeDocuments_ReuseParsedPath(t *testing.T) {
+	var src, dst map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers": [{"name": "src1"}, {"name": "src2"}]}`), &src)
+	err2 := json.Unmarshal([]byte(`{"layers": [{"name": "dst1"}, {"name": "dst2"}]}`), &dst)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	mergeDoc := MergeDocuments{src, dst}
+	path, _ := ParsePath(`$["layers"][1]["name"]`)
+
+	for i := 0; i < 2; i++ {
+		if err := mergeDoc.setMapElement(path, path); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+		if path.String() != `$["layers"][1]["name"]` {
+			t.Fatalf("Path changed by merge %v", path)
+		}
+	}
+
+	if name := dst["layers"].([]interface{})[1].(map[string]interface{})["name"]; name != "src2" {
+		t.Errorf("Expected src2, got %v", name)
+	}
+}
+
+func TestSerialize_RoundTrip(t *testing.T) {
+	keys := []string{"_class", "do_objectID", "0", "900F2395-B6A0-4A36-AFBF-AE318EB53D6D/_stringValue",
+		"key.with.dots", "..", "*", "", `quote"d`, "a]b", "[x]", `back\slash`, `\"]`, "Überschrift 1", "-1", "1:2"}
+
+	for _, key := range keys {
+		path := NewPath().Key("layers").ObjectID("do_objectID", key).Key(key).Index(-1).WithAction(ValueDelete)
+		serialized := Serialize(path)
+
+		parsed, err := ParsePath(serialized)
+		if err != nil {
+			t.Errorf("Parse of %v failed: %v", serialized, err)
+			continue
+		}
+
+		if Serialize(parsed) != serialized || parsed.Action() != ValueDelete || parsed.Len() != 4 {
+			t.Errorf("Round trip of %v gave %v", serialized, Serialize(parsed))
+			continue
+		}
+
+		if parsed.Segment(1).(*ObjectIDSelection).Value != key || parsed.Segment(2).(*MapSelection).Key != key {
+			t.Errorf("Unexpected keys of %v: %v %v", serialized, parsed.Segment(1), parsed.Segment(2))
+		}
+
+		sel, _, err := Parse(serialized)
+		if err != nil || Serialize(NodePath(sel).WithAction(ValueDelete)) != serialized {
+			t.Errorf("Node chain of %v does not round trip: %v", serialized, err)
+		}
+	}
+}
+
+func TestCompare_EscapedKeys(t *testing.T) {
+	var doc1, doc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"overrides": {"a]b": 1, "quote\"d": {"[x]": 2}}}`), &doc1)
+	err2 := json.Unmarshal([]byte(`{"overrides": {"a]b": 3, "quote\"d": {"[x]": 4}}}`), &doc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Compare(doc1, doc2, "$")
+
+	mergeDoc := MergeDocuments{doc1, doc2}
+	for key, item := range jsCompare.Doc1Diffs {
+		if err := mergeDoc.MergeByJSONPath(key, item.(string)); err != nil {
+			t.Errorf("Merge of %v failed: %v", key, err)
+		}
+	}
+
+	overrides := doc2["overrides"].(map[string]interface{})
+	if overrides["a]b"] != float64(1) || overrides[`quote"d`].(map[string]interface{})["[x]"] != float64(2) {
+		t.Errorf("Unexpected merge result %v", overrides)
+	}
+}
@@ -0,0 +1,269 @@
+package sketchmerge
+
+import (
+	"sort"
+)
+
+//Single merge action of the plan
+type MergeStep struct {
+	Action ApplyAction
+	//path in src document, empty for delete
+	SrcPath string
+	//path in dst document, shifted by deletes applied before the step
+	DstPath string
+}
+
+//Ordered merge actions of one document
+//Changes go first, then deletes by descending index, then adds by ascending index and sequence changes
+//of deeper containers before the ones of their ancestors, moves last,
+//so index based paths never point to elements shifted or reordered by another step of the same batch
+type MergePlan struct {
+	ObjectKeyName string
+	Steps []MergeStep
+
+	//identities of array elements reordered by sequence steps
+	identities []ArrayIdentity
+
+	//differences of arrays without identity were found by longest common subsequence, so their adds keep src index
+	lcsMatching bool
+}
+
+//Plans application of src to dst differences of jsc
+//The same differences always give the same plan
+func PlanMerge(jsc *JsonStructureCompare) MergePlan {
+	plan := MergePlan{ObjectKeyName: jsc.ObjectKeyName, Steps: make([]MergeStep, 0, len(jsc.Doc1Diffs) + len(jsc.Doc1SeqDiffs)), identities: jsc.Options.arrayIdentities(), lcsMatching: jsc.Options.LCSMatching}
+
+	//arrays without object keys are replaced as a whole, differences of their elements are skipped
+	replaced := replacedPaths(jsc.Doc1Diffs)
+
+	changes := make([]string, 0)
+	deletes := make([]string, 0)
+	adds := make([]string, 0)
+	for key, item := range jsc.Doc1Diffs {
+		switch {
+		case isDeleteDiff(key):
+			if !isReplaced(replaced, key[1:], false) {
+				deletes = append(deletes, key)
+			}
+		case isAddDiff(key):
+			if !isReplaced(replaced, toString(item), true) {
+				adds = append(adds, key)
+			}
+		default:
+			if !isReplaced(replaced, toString(item), false) {
+				changes = append(changes, key)
+			}
+		}
+	}
+
+	sortPaths(changes, false)
+	sortPaths(deletes, true)
+	sortPaths(adds, false)
+
+	for _, key := range changes {
+		plan.Steps = append(plan.Steps, MergeStep{ValueChange, key, toString(jsc.Doc1Diffs[key])})
+	}
+
+	deleted := deletedIndices(deletes)
+	for _, key := range deletes {
+		plan.Steps = append(plan.Steps, MergeStep{ValueDelete, "", key})
+	}
+
+	//inserts and reorders of a container shift indices of paths nested in it only, so deeper containers go first
+	sequences := make([]string, 0, len(jsc.Doc1SeqDiffs))
+	for key := range jsc.Doc1SeqDiffs {
+		sequences = append(sequences, key)
+	}
+	sortPaths(sequences, false)
+
+	for len(adds) > 0 || len(sequences) > 0 {
+		depth := -1
+		for _, key := range adds {
+			if d := containerDepth(key, true); d > depth {
+				depth = d
+			}
+		}
+		for _, key := range sequences {
+			if d := containerDepth(key, false); d > depth {
+				depth = d
+			}
+		}
+
+		adds = plan.addSteps(adds, depth, true, func(key string) MergeStep {
+			return MergeStep{ValueAdd, key, shiftPath(toString(jsc.Doc1Diffs[key]), deleted)}
+		})
+		sequences = plan.addSteps(sequences, depth, false, func(key string) MergeStep {
+			return MergeStep{SequenceChange, key, shiftPath(toString(jsc.Doc1SeqDiffs[key]), deleted)}
+		})
+	}
+
+	//moved objects are looked up by object key and placed next to their src siblings already put in src order
+	moves := make([]string, 0, len(jsc.Doc1MoveDiffs))
+	for key := range jsc.Doc1MoveDiffs {
+		moves = append(moves, key)
+	}
+	sortPaths(moves, false)
+
+	for _, key := range moves {
+		plan.Steps = append(plan.Steps, MergeStep{ValueMove, key, shiftPath(toString(jsc.Doc1MoveDiffs[key]), deleted)})
+	}
+
+	return plan
+}
+
+//Appends steps of keys with container at depth, gets the rest of keys
+func (plan *MergePlan) addSteps(keys []string, depth int, isAdd bool, step func(key string) MergeStep) []string {
+	rest := keys[:0]
+	for _, key := range keys {
+		if containerDepth(key, isAdd) == depth {
+			plan.Steps = append(plan.Steps, step(key))
+		} else {
+			rest = append(rest, key)
+		}
+	}
+	return rest
+}
+
+//Gets number of segments of path of the container changed by difference, added nodes are in container of their parent
+func containerDepth(key string, isAdd bool) int {
+	path, err := ParsePath(key)
+	if err != nil {
+		return 0
+	}
+	if isAdd && !path.IsRoot() {
+		return path.Len() - 1
+	}
+	return path.Len()
+}
+
+//Gets dst paths of nodes replaced by change differences
+func replacedPaths(diffs map[string]interface{}) []string {
+	replaced := make([]string, 0)
+	for key, item := range diffs {
+		if !isAddDiff(key) && !isDeleteDiff(key) {
+			replaced = append(replaced, toString(item))
+		}
+	}
+	return replaced
+}
+
+//Checks whether dst path is inside of replaced node, self tells whether the replaced node itself counts
+func isReplaced(replaced []string, path string, self bool) bool {
+	for _, replacedPath := range replaced {
+		if isPathPrefix(replacedPath, path) && (self || replacedPath != path) {
+			return true
+		}
+	}
+	return false
+}
+
+//Applies steps of the plan in order, failed steps don't stop the rest of the plan
+//Gets errors of steps by their position in the plan, nil for applied steps
+func (md * MergeDocuments) ApplyPlan(plan MergePlan) []error {
+	errs := make([]error, len(plan.Steps))
+	for i, step := range plan.Steps {
+		errs[i] = md.applyPlanStep(plan, step)
+	}
+	return errs
+}
+
+//Applies step of the plan, arrays are reordered by their identities
+func (md * MergeDocuments) applyPlanStep(plan MergePlan, step MergeStep) error {
+	if step.Action == SequenceChange {
+		return md.MergeSequenceBy(plan.sequenceIdentity(md.SrcDocument, step.SrcPath), step.SrcPath, step.DstPath)
+	}
+	if step.Action == ValueAdd && plan.lcsMatching {
+		return md.addSimilarElement(plan.identities, plan.ObjectKeyName, step.SrcPath, step.DstPath)
+	}
+	return md.ApplyStep(plan.ObjectKeyName, step)
+}
+
+//Gets identity of elements of src array reordered by sequence step
+func (plan MergePlan) sequenceIdentity(srcDocument map[string]interface{}, srcPath string) IdentityFunc {
+	return arrayIdentity(plan.identities, plan.ObjectKeyName, srcDocument, srcPath)
+}
+
+//Applies single step of the merge plan
+func (md * MergeDocuments) ApplyStep(objectKeyName string, step MergeStep) error {
+	switch step.Action {
+	case SequenceChange:
+		return md.MergeSequenceByJSONPath(objectKeyName, step.SrcPath, step.DstPath)
+	case ValueMove:
+		return md.MoveByJSONPath(objectKeyName, step.SrcPath, step.DstPath)
+	}
+	return md.MergeByJSONPath(step.SrcPath, step.DstPath)
+}
+
+//Sorts paths deterministically, elements of one array by their index
+func sortPaths(paths []string, isDesc bool) {
+	sort.Strings(paths)
+	sort.SliceStable(paths, func(i, j int) bool {
+		if isDesc {
+			return lessPath(paths[j], paths[i])
+		}
+		return lessPath(paths[i], paths[j])
+	})
+}
+
+//Gets indices of deleted array elements by path of their array
+func deletedIndices(deletes []string) map[string][]int {
+	deleted := make(map[string][]int)
+	for _, key := range deletes {
+		path, err := ParsePath(key)
+		if err != nil || path.IsRoot() {
+			continue
+		}
+
+		if sel, ok := path.Last().(*ArraySelection); ok && sel.Key >= 0 {
+			parent := path.Parent().String()
+			deleted[parent] = append(deleted[parent], sel.Key)
+		}
+	}
+	return deleted
+}
+
+//Shifts array indices of dst path by the number of elements deleted before them
+func shiftPath(dstPath string, deleted map[string][]int) string {
+	if len(deleted) == 0 {
+		return dstPath
+	}
+
+	path, err := ParsePath(dstPath)
+	if err != nil {
+		return dstPath
+	}
+
+	shifted := NewPath().WithAction(path.Action())
+	prefix := NewPath()
+	isShifted := false
+	for i := 0; i < path.Len(); i++ {
+		segment := path.Segment(i)
+		if sel, ok := segment.(*ArraySelection); ok && sel.Key >= 0 {
+			count := 0
+			for _, index := range deleted[prefix.String()] {
+				if index < sel.Key {
+					count++
+				}
+			}
+			if count > 0 {
+				segment = &ArraySelection{Key: sel.Key - count}
+				isShifted = true
+			}
+		}
+		prefix = prefix.Append(path.Segment(i))
+		shifted = shifted.Append(segment)
+	}
+
+	if !isShifted {
+		return dstPath
+	}
+
+	//keep JSON Pointer format of the diff
+	if isPointer(dstPath) {
+		if pointer, err := ToPointer(shifted); err == nil {
+			return pointer
+		}
+	}
+	return shifted.String()
+}
+
@@ -0,0 +1,260 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPlanMerge(t *testing.T) {
+	src := `{"layers":[
+			{"do_objectID": "A", "layers": [{"do_objectID": "A1"}, {"do_objectID": "A2"}, {"do_objectID": "A3"}]},
+			{"do_objectID": "C"}
+		]}`
+	dst := `{"layers":[
+			{"do_objectID": "X"},
+			{"do_objectID": "A", "layers": [{"do_objectID": "A1"}]},
+			{"do_objectID": "Y"},
+			{"do_objectID": "C"}
+		]}`
+
+	var results []string
+	for run := 0; run < 5; run++ {
+		var jsonDoc1, jsonDoc2 map[string]interface{}
+		err1 := json.Unmarshal([]byte(src), &jsonDoc1)
+		err2 := json.Unmarshal([]byte(dst), &jsonDoc2)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("Error occured %v %v", err1, err2)
+		}
+
+		jsCompare := NewJsonStructureCompare()
+		jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+		plan := PlanMerge(jsCompare)
+		expected := []MergeStep{
+			{ValueDelete, "", `-$["layers"][2]`},
+			{ValueDelete, "", `-$["layers"][0]`},
+			{ValueAdd, `+$["layers"][0]["layers"][1]`, `$["layers"][0]["layers"]`},
+			{ValueAdd, `+$["layers"][0]["layers"][2]`, `$["layers"][0]["layers"]`},
+			{SequenceChange, `$["layers"][0]["layers"]`, `$["layers"][0]["layers"]`},
+			{SequenceChange, `$["layers"]`, `$["layers"]`},
+		}
+		if !reflect.DeepEqual(plan.Steps, expected) {
+			t.Fatalf("Unexpected plan %v", plan.Steps)
+		}
+
+		mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+		for i, err := range mergeDoc.ApplyPlan(plan) {
+			if err != nil {
+				t.Errorf("Step %v failed: %v", plan.Steps[i], err)
+			}
+		}
+
+		data, _ := json.Marshal(mergeDoc.DstDocument)
+		results = append(results, string(data))
+
+		if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+			t.Errorf("Expected merged document equal to src, got %s", data)
+		}
+	}
+
+	for _, result := range results {
+		if result != results[0] {
+			t.Errorf("Merge results differ between runs %v %v", result, results[0])
+		}
+	}
+}
+
+func TestPlanMerge_ArraysWithoutObjectKey(t *testing.T) {
+	cases := []struct {
+		src string
+		dst string
+	}{
+		{`{"a": [1, 2, 3, 4]}`, `{"a": [1, 2, 3]}`},
+		{`{"a": [1, 5, 3, 4]}`, `{"a": [1, 2]}`},
+		{`{"a": [1, 2]}`, `{"a": [1, 5, 3, 4]}`},
+		{`{"a": [3]}`, `{"a": [1, 2, 3]}`},
+		{`{"a": [{"x": 1}, {"x": 2}]}`, `{"a": [{"x": 3}]}`},
+	}
+
+	for _, c := range cases {
+		var jsonDoc1, jsonDoc2 map[string]interface{}
+		err1 := json.Unmarshal([]byte(c.src), &jsonDoc1)
+		err2 := json.Unmarshal([]byte(c.dst), &jsonDoc2)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("Error occured %v %v", err1, err2)
+		}
+
+		jsCompare := NewJsonStructureCompare()
+		jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+		//replaced array makes steps of its elements redundant
+		plan := PlanMerge(jsCompare)
+		expected := []MergeStep{{ValueChange, `$["a"]`, `$["a"]`}}
+		if !reflect.DeepEqual(plan.Steps, expected) {
+			t.Errorf("Unexpected plan of %v into %v: %v", c.src, c.dst, plan.Steps)
+		}
+
+		mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+		for i, err := range mergeDoc.ApplyPlan(plan) {
+			if err != nil {
+				t.Errorf("Step %v failed: %v", plan.Steps[i], err)
+			}
+		}
+
+		if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+			data, _ := json.Marshal(mergeDoc.DstDocument)
+			t.Errorf("Expected %v merged into %v to be equal to src, got %s", c.src, c.dst, data)
+		}
+	}
+}
+
+func TestPlanMerge_RoundTrip(t *testing.T) {
+	//nested adds into an element go before inserts shifting it
+	pairs := [][2]string{{`{"layers": [{"do_objectID": "ID6469"}, {"do_objectID": "ID6468", "extra": "e"}]}`,
+		`{"layers": [{"do_objectID": "ID6467"}, {"do_objectID": "ID6468"}]}`}}
+
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 400; i++ {
+		src := map[string]interface{}{"layers": randomLayers(random, make(map[string]bool), 2)}
+		dst := map[string]interface{}{"layers": randomLayers(random, make(map[string]bool), 2)}
+		srcData, _ := json.Marshal(src)
+		dstData, _ := json.Marshal(dst)
+		pairs = append(pairs, [2]string{string(srcData), string(dstData)})
+	}
+
+	for _, options := range []CompareOptions{{}, {DetectMoves: true}, {LCSMatching: true}} {
+		for _, pair := range pairs {
+			var jsonDoc1, jsonDoc2 map[string]interface{}
+			err1 := json.Unmarshal([]byte(pair[0]), &jsonDoc1)
+			err2 := json.Unmarshal([]byte(pair[1]), &jsonDoc2)
+			if err1 != nil || err2 != nil {
+				t.Fatalf("Error occured %v %v", err1, err2)
+			}
+
+			jsCompare := NewJsonStructureCompare()
+			jsCompare.Options = options
+			jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+			plan := PlanMerge(jsCompare)
+			mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
+			for i, err := range mergeDoc.ApplyPlan(plan) {
+				if err != nil {
+					t.Errorf("Step %v of %v into %v failed: %v", plan.Steps[i], pair[0], pair[1], err)
+				}
+			}
+
+			if !reflect.DeepEqual(mergeDoc.DstDocument, mergeDoc.SrcDocument) {
+				data, _ := json.Marshal(mergeDoc.DstDocument)
+				t.Fatalf("Expected %v merged into %v to be equal to src, got %s", pair[0], pair[1], data)
+			}
+		}
+	}
+}
+
+//Builds random layers with ids unique within the document, the same ids are likely in other documents
+func randomLayers(random *rand.Rand, used map[string]bool, depth int) []interface{} {
+	layers := make([]interface{}, 0)
+	for i := random.Intn(4); i > 0; i-- {
+		id := fmt.Sprintf("ID%d", 6460 + random.Intn(12))
+		if used[id] {
+			continue
+		}
+		used[id] = true
+
+		layer := map[string]interface{}{"do_objectID": id}
+		if random.Intn(2) == 0 {
+			layer["name"] = fmt.Sprintf("name%d", random.Intn(3))
+		}
+		if random.Intn(3) == 0 {
+			layer["extra"] = "e"
+		}
+		if depth > 0 && random.Intn(2) == 0 {
+			layer["layers"] = randomLayers(random, used, depth - 1)
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+func TestShiftPath(t *testing.T) {
+	deleted := deletedIndices([]string{`-$["layers"][3]`, `-$["layers"][0]`, `-$["layers"][1]["layers"][0]`})
+
+	cases := map[string]string{
+		`$["layers"][2]["layers"]`: `$["layers"][1]["layers"]`,
+		`$["layers"][5]["layers"]`: `$["layers"][3]["layers"]`,
+		`$["layers"][1]["layers"][2]`: `$["layers"][0]["layers"][1]`,
+		`$["points"][2]`: `$["points"][2]`,
+		`/layers/2/layers`: `/layers/1/layers`,
+	}
+
+	for path, expected := range cases {
+		if shifted := shiftPath(path, deleted); shifted != expected {
+			t.Errorf("Expected %v shifted to %v, got %v", path, expected, shifted)
+		}
+	}
+}
+
+func TestProcessFileMerge_DryRun(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	dstDoc := []byte(`{"name": "old", "layers": [{"do_objectID": "A"}]}`)
+	mergeFile := filepath.Join(srcDir, "merge.json")
+	files := map[string][]byte{
+		filepath.Join(srcDir, "document.json"): []byte(`{"name": "new", "layers": [{"do_objectID": "A"}]}`),
+		filepath.Join(dstDir, "document.json"): dstDoc,
+		mergeFile: []byte(`{"merge_actions": [{"file_key": "document", "file_ext": ".json", "file_diff": {
+			"src_to_dst_diff": {"$[\"name\"]": "$[\"name\"]", "-$[\"layers\"][3]": ""}}},
+			{"file_key": "meta", "file_ext": ".json", "file_diff": {}}]}`),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+	}
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+
+	if len(report.Files) != 2 || report.Files[0].Document["name"] != "new" {
+		t.Fatalf("Expected resulting document, got %v", report.Files)
+	}
+
+	expected := []StepResult{
+		{ValueChange, `$["name"]`, `$["name"]`, ActionApplied, ""},
+		{ValueDelete, "", `-$["layers"][3]`, ActionFailed, IndexOutOfBounds.Error()},
+	}
+	if !reflect.DeepEqual(report.Files[0].Steps, expected) {
+		t.Errorf("Unexpected steps report %v", report.Files[0].Steps)
+	}
+
+	if report.Files[0].Status != ActionFailed || report.Files[1].Status != ActionSkipped {
+		t.Errorf("Unexpected files status %v", report.Files)
+	}
+
+	if !report.HasFailures() || len(report.Failures()) != 1 {
+		t.Errorf("Expected failed delete in report %v", report.Failures())
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dstDir, "document.json"))
+	if err != nil || string(data) != string(dstDoc) {
+		t.Errorf("Dry run should keep dst file untouched, got %s %v", data, err)
+	}
+}
@@ -0,0 +1,150 @@
+package sketchmerge
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Format of paths in diff output
+type PathFormat uint8
+
+const (
+	//jsonpath, e.g. $["layers"][0]["frame"]["x"]
+	JSONPathFormat = iota
+	//RFC 6901 JSON Pointer, e.g. /layers/0/frame/x
+	JSONPointerFormat
+)
+
+var NotPointerPath = errors.New("Path can't be represented as JSON Pointer.")
+
+var (
+	pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+//Checks whether path with optional action prefix is JSON Pointer
+func isPointer(s string) bool {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return len(s) > 0 && s[0] == '/'
+}
+
+//Parses JSON Pointer reference tokens into selection nodes
+//Tokens looking like array indices select array element or map property depending on the document
+func parsePointer(s string) []Node {
+	tokens := strings.Split(s[1:], "/")
+	nodes := make([]Node, 0, len(tokens))
+
+	for _, token := range tokens {
+		token = pointerUnescaper.Replace(token)
+		if index, ok := pointerIndex(token); ok {
+			nodes = append(nodes, &ArraySelection{Key: index, Token: token})
+		} else {
+			nodes = append(nodes, &MapSelection{Key: token})
+		}
+	}
+	return nodes
+}
+
+//Gets array index of JSON Pointer token, leading zeros are not allowed by RFC 6901
+func pointerIndex(token string) (int, bool) {
+	if token == "" || (token[0] == '0' && len(token) > 1) {
+		return 0, false
+	}
+	for i := 0; i < len(token); i++ {
+		if token[i] < '0' || token[i] > '9' {
+			return 0, false
+		}
+	}
+	index, err := strconv.Atoi(token)
+	return index, err == nil
+}
+
+//Builds JSON Pointer reference token of map key
+func PointerSegment(key string) string {
+	return "/" + pointerEscaper.Replace(key)
+}
+
+//Builds JSON Pointer of concrete path, paths with object key or pattern segments have no pointer
+func ToPointer(p Path) (string, error) {
+	s := ""
+	switch p.action {
+	case ValueAdd:
+		s = "+"
+	case ValueDelete:
+		s = "-"
+	}
+
+	for _, segment := range p.segments {
+		switch sel := segment.(type) {
+		case *MapSelection:
+			s += PointerSegment(sel.Key)
+		case *ArraySelection:
+			if sel.Key < 0 {
+				return "", NotPointerPath
+			}
+			s += "/" + strconv.Itoa(sel.Key)
+		default:
+			return "", NotPointerPath
+		}
+	}
+	return s, nil
+}
+
+//Gets map key selected by segment in container
+//Index tokens of JSON Pointer select map property when container is map
+func mapKey(segment Node, container interface{}) (string, bool) {
+	switch sel := segment.(type) {
+	case *MapSelection:
+		return sel.Key, true
+	case *ArraySelection:
+		if _, isMap := container.(map[string]interface{}); isMap && sel.Token != "" {
+			return sel.Token, true
+		}
+	}
+	return "", false
+}
+
+//Builds path with the last segment bound to the type of its container in doc
+func (p Path) bindLast(doc interface{}) Path {
+	last, ok := p.Last().(*ArraySelection)
+	if !ok || last.Token == "" {
+		return p
+	}
+
+	container, err := p.Parent().Resolve(doc)
+	if err != nil {
+		return p
+	}
+
+	if key, ok := mapKey(last, container); ok {
+		return p.Parent().Key(key).WithAction(p.action)
+	}
+	return p
+}
+
+//Builds path of property of map in configured format
+func (jsc * JsonStructureCompare) keyPath(path string, key string) string {
+	if jsc.Options.PathFormat == JSONPointerFormat {
+		return path + PointerSegment(key)
+	}
+	return path + KeySegment(key)
+}
+
+//Builds path of array element by index in configured format
+func (jsc * JsonStructureCompare) indexPath(path string, index int) string {
+	if jsc.Options.PathFormat == JSONPointerFormat {
+		return path + "/" + strconv.Itoa(index)
+	}
+	return path + IndexSegment(index)
+}
+
+//Gets root path in configured format
+func (jsc * JsonStructureCompare) rootPath(path string) string {
+	if jsc.Options.PathFormat == JSONPointerFormat && path == "$" {
+		return ""
+	}
+	return path
+}
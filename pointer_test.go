@@ -0,0 +1,123 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParse_JSONPointer(t *testing.T) {
+	var doc map[string]interface{}
+	err := json.Unmarshal([]byte(`{"layers": [{"frame": {"x": 5}}, {"overrides": {"0": "zero", "a/b": "slash", "m~n": "tilde"}}]}`), &doc)
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	tests := map[string]interface{}{
+		"/layers/0/frame/x": float64(5),
+		"/layers/1/overrides/0": "zero",
+		"/layers/1/overrides/a~1b": "slash",
+		"/layers/1/overrides/m~0n": "tilde",
+	}
+
+	for pointer, expected := range tests {
+		sel, _, err := Parse(pointer)
+		if err != nil {
+			t.Errorf("Parse of %v failed: %v", pointer, err)
+			continue
+		}
+		if value, _, err := sel.Apply(doc); err != nil || value != expected {
+			t.Errorf("Apply of %v: expected %v, got %v %v", pointer, expected, value, err)
+		}
+	}
+
+	path, err := ParsePath("-/layers/1/overrides/a~1b")
+	if err != nil || path.Action() != ValueDelete {
+		t.Fatalf("Parse failed: %v %v", path, err)
+	}
+
+	if pointer, err := ToPointer(path); err != nil || pointer != "-/layers/1/overrides/a~1b" {
+		t.Errorf("Unexpected pointer %v %v", pointer, err)
+	}
+
+	if _, err := ToPointer(NewPath().Key("layers").ObjectID("do_objectID", "1")); err != NotPointerPath {
+		t.Errorf("Expected NotPointerPath, got %v", err)
+	}
+}
+
+func TestJsonStructureCompare_JSONPointerFormat(t *testing.T) {
+	var doc1, doc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"layers": [{"do_objectID": "1", "frame": {"x": 5}}], "overrides": {"0": "zero", "a/b": "new"}}`), &doc1)
+	err2 := json.Unmarshal([]byte(`{"layers": [{"do_objectID": "1", "frame": {"x": 6}}, {"do_objectID": "2"}], "overrides": {"0": "one"}}`), &doc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.PathFormat = JSONPointerFormat
+	jsCompare.Compare(doc1, doc2, "$")
+
+	expected := map[string]interface{}{
+		"/layers/0/frame/x": "/layers/0/frame/x",
+		"-/layers/1": "",
+		"/overrides/0": "/overrides/0",
+		"+/overrides/a~1b": "/overrides",
+	}
+
+	if !reflect.DeepEqual(jsCompare.Doc1Diffs, expected) {
+		t.Fatalf("Unexpected diffs %v", jsCompare.Doc1Diffs)
+	}
+
+	mergeDoc := MergeDocuments{doc1, doc2}
+	for key, item := range jsCompare.Doc1Diffs {
+		if item == "" {
+			continue
+		}
+		if err := mergeDoc.MergeByJSONPath(key, item.(string)); err != nil {
+			t.Errorf("Merge of %v failed: %v", key, err)
+		}
+	}
+
+	if err := mergeDoc.MergeByJSONPath("", "-/layers/1"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(doc1, doc2) {
+		t.Errorf("Expected documents to be equal after merge, got %v", doc2)
+	}
+}
+
+func TestJsonStructureCompare_JSONPointerRootAdd(t *testing.T) {
+	var doc1, doc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"a": 1, "b": 2}`), &doc1)
+	err2 := json.Unmarshal([]byte(`{"a": 1, "c": 3}`), &doc2)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.PathFormat = JSONPointerFormat
+	jsCompare.Compare(doc1, doc2, "$")
+
+	//parent of added top level key is empty root pointer, the same as value of deleted node
+	expected := map[string]interface{}{"+/b": "", "-/c": ""}
+	if !reflect.DeepEqual(jsCompare.Doc1Diffs, expected) {
+		t.Fatalf("Unexpected diffs %v", jsCompare.Doc1Diffs)
+	}
+
+	plan := PlanMerge(jsCompare)
+	if steps := []MergeStep{{ValueDelete, "", "-/c"}, {ValueAdd, "+/b", ""}}; !reflect.DeepEqual(plan.Steps, steps) {
+		t.Errorf("Expected add and delete steps, got %v", plan.Steps)
+	}
+
+	mergeDoc := MergeDocuments{doc1, doc2}
+	for i, err := range mergeDoc.ApplyPlan(plan) {
+		if err != nil {
+			t.Errorf("Step %v failed: %v", plan.Steps[i], err)
+		}
+	}
+
+	if !reflect.DeepEqual(doc1, doc2) {
+		t.Errorf("Expected documents to be equal after merge, got %v", doc2)
+	}
+}
@@ -0,0 +1,265 @@
+package sketchmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Strategy resolving conflicting changes of ours and theirs
+type ResolutionStrategy string
+
+const (
+	//keep ours change
+	ResolveOurs ResolutionStrategy = "ours"
+	//take theirs change
+	ResolveTheirs ResolutionStrategy = "theirs"
+	//keep children of both sides, ours wins for children present on both sides
+	ResolveUnion ResolutionStrategy = "union"
+	//take change of the side considered newer by saveHistory of meta.json, see IsTheirsNewer
+	//saveHistory has no save times, so it's an approximation, not the side saved last
+	ResolveNewest ResolutionStrategy = "newest"
+)
+
+var UnknownStrategy = errors.New("Unknown resolution strategy.")
+
+//Rule selecting strategy for conflicts matching all of its non empty conditions
+type ResolutionRule struct {
+	//regular expression for jsonpath of conflicting node in base document
+	Path string `json:"path,omitempty"`
+	//name of a property on the path, e.g. style for all style subtrees
+	Key string `json:"key,omitempty"`
+	//_class of the conflicting node or one of its ancestors
+	Class string `json:"class,omitempty"`
+	Strategy ResolutionStrategy `json:"strategy"`
+
+	pathReg *regexp.Regexp
+}
+
+//Conflict resolution policy, the first matching rule wins
+//Path expressions are compiled by NewMergePolicy, LoadMergePolicy or Compile, rules with path don't match until then
+type MergePolicy struct {
+	Default ResolutionStrategy `json:"default,omitempty"`
+	Rules []ResolutionRule `json:"rules,omitempty"`
+}
+
+//Creates merge policy with compiled path expressions of the rules
+func NewMergePolicy(defaultStrategy ResolutionStrategy, rules []ResolutionRule) (*MergePolicy, error) {
+	policy := &MergePolicy{Default: defaultStrategy, Rules: append([]ResolutionRule(nil), rules...)}
+
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+//Reads merge policy from json file
+func LoadMergePolicy(policyFile string) (*MergePolicy, error) {
+	data, err := ioutil.ReadFile(policyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := new(MergePolicy)
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(policy); err != nil {
+		return nil, err
+	}
+
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func isValidStrategy(strategy ResolutionStrategy) bool {
+	switch strategy {
+	case ResolveOurs, ResolveTheirs, ResolveUnion, ResolveNewest:
+		return true
+	}
+	return false
+}
+
+//Validates strategies and compiles path expressions of the rules
+func (mp *MergePolicy) Compile() error {
+	if mp.Default != "" && !isValidStrategy(mp.Default) {
+		return UnknownStrategy
+	}
+
+	for i := range mp.Rules {
+		if !isValidStrategy(mp.Rules[i].Strategy) {
+			return UnknownStrategy
+		}
+
+		if mp.Rules[i].Path == "" {
+			continue
+		}
+
+		reg, err := regexp.Compile(mp.Rules[i].Path)
+		if err != nil {
+			return err
+		}
+		mp.Rules[i].pathReg = reg
+	}
+
+	return nil
+}
+
+func (rule *ResolutionRule) matches(path string, keys []string, classes []string) bool {
+	if rule.Path != "" {
+		if rule.pathReg == nil || !rule.pathReg.MatchString(path) {
+			return false
+		}
+	}
+
+	if rule.Key != "" && !containsString(keys, rule.Key) {
+		return false
+	}
+
+	if rule.Class != "" && !containsString(classes, rule.Class) {
+		return false
+	}
+
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Selects strategy for conflicting node at path of base document
+func (mp *MergePolicy) Strategy(doc map[string]interface{}, path string) ResolutionStrategy {
+	if mp == nil {
+		return ResolveOurs
+	}
+
+	keys, classes := pathKeysAndClasses(doc, path)
+
+	for i := range mp.Rules {
+		if mp.Rules[i].matches(path, keys, classes) {
+			return mp.Rules[i].Strategy
+		}
+	}
+
+	if mp.Default == "" {
+		return ResolveOurs
+	}
+	return mp.Default
+}
+
+//Gets property names on path and _class values of the nodes along path in doc
+func pathKeysAndClasses(doc map[string]interface{}, path string) ([]string, []string) {
+	keys := make([]string, 0)
+	classes := make([]string, 0)
+
+	sel, _, err := Parse(path)
+	if err != nil {
+		return keys, classes
+	}
+
+	for node := sel.GetNext(); node != nil; node = node.GetNext() {
+		if mapNode, ok := node.(*MapSelection); ok {
+			keys = append(keys, mapNode.Key)
+		}
+	}
+
+	sel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
+		if vMap, isMap := v.(map[string]interface{}); isMap {
+			if class, ok := vMap["_class"].(string); ok {
+				classes = append(classes, class)
+			}
+		}
+		return true
+	})
+
+	return keys, classes
+}
+
+//Gets build number of Sketch app of the last save and number of saves from saveHistory of meta.json
+//Entries are app versions like "NONAPPSTORE.51160", they tell which Sketch build saved the file, not when
+func lastSaveBuild(meta map[string]interface{}) (int, int) {
+	history, _ := meta["saveHistory"].([]interface{})
+	if len(history) == 0 {
+		return 0, 0
+	}
+
+	last, _ := history[len(history)-1].(string)
+	build, _ := strconv.Atoi(last[strings.LastIndex(last, ".")+1:])
+
+	return build, len(history)
+}
+
+//Checks whether theirs sketch file is newer than ours by their meta.json
+//meta.json has no save time, so newer means saved by a later Sketch build, or by the same build more times.
+//File saved long ago by a newer build counts as newer, ResolveNewest shouldn't be used when sides use different builds
+func IsTheirsNewer(oursMeta map[string]interface{}, theirsMeta map[string]interface{}) bool {
+	oursBuild, oursSaves := lastSaveBuild(oursMeta)
+	theirsBuild, theirsSaves := lastSaveBuild(theirsMeta)
+
+	if theirsBuild != oursBuild {
+		return theirsBuild > oursBuild
+	}
+	return theirsSaves > oursSaves
+}
+
+//Builds union of children of ours and theirs containers
+//Children of ours are kept, children only theirs has are appended
+func unionOfChildren(objectKeyName string, ours interface{}, theirs interface{}) (interface{}, bool) {
+	switch oursValue := ours.(type) {
+	case map[string]interface{}:
+		theirsMap, ok := theirs.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		union := make(map[string]interface{}, len(oursValue))
+		for key, item := range theirsMap {
+			union[key] = item
+		}
+		for key, item := range oursValue {
+			union[key] = item
+		}
+		return union, true
+	case []interface{}:
+		theirsArr, ok := theirs.([]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		union := make([]interface{}, len(oursValue), len(oursValue) + len(theirsArr))
+		copy(union, oursValue)
+		for _, item := range theirsArr {
+			if !containsElement(objectKeyName, oursValue, item) {
+				union = append(union, item)
+			}
+		}
+		return union, true
+	}
+
+	return nil, false
+}
+
+//Checks whether arr has the element with the same object key or equal to item
+func containsElement(objectKeyName string, arr []interface{}, item interface{}) bool {
+	if itemMap, isMap := item.(map[string]interface{}); isMap && itemMap[objectKeyName] != nil {
+		return indexOfObject(objectKeyName, itemMap[objectKeyName], arr) != -1
+	}
+
+	for _, element := range arr {
+		if reflect.DeepEqual(element, item) {
+			return true
+		}
+	}
+	return false
+}
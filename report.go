@@ -0,0 +1,151 @@
+package sketchmerge
+
+import (
+	"fmt"
+)
+
+//Outcome of merge action
+type ActionStatus string
+
+const (
+	ActionApplied ActionStatus = "applied"
+	//nothing to do, e.g. deleted element is already missing in dst
+	ActionSkipped ActionStatus = "skipped"
+	ActionFailed ActionStatus = "failed"
+)
+
+//Result of single merge step
+type StepResult struct {
+	Action ApplyAction `json:"action"`
+	SrcPath string `json:"src_path,omitempty"`
+	DstPath string `json:"dst_path,omitempty"`
+	Status ActionStatus `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+//Result of merge of one file
+type MergeResult struct {
+	FileKey string `json:"file_key"`
+	FileExt string `json:"file_ext"`
+	Status ActionStatus `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	//resulting document, given only for dry run
+	Document map[string]interface{} `json:"document,omitempty"`
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+//Report of every merge action of merge file
+type MergeReport struct {
+	Files []MergeResult `json:"files"`
+	//no file was written because some action failed
+	RolledBack bool `json:"rolled_back,omitempty"`
+}
+
+//Builds results of plan steps from errors returned by ApplyPlan
+func stepResults(plan MergePlan, errs []error) []StepResult {
+	results := make([]StepResult, len(plan.Steps))
+	for i, step := range plan.Steps {
+		results[i] = StepResult{Action: step.Action, SrcPath: step.SrcPath, DstPath: step.DstPath, Status: ActionApplied}
+		switch {
+		case errs[i] == nil:
+		case errs[i] == NotFound && step.Action == ValueDelete:
+			results[i].Status = ActionSkipped
+			results[i].Reason = "already deleted"
+		default:
+			results[i].Status = ActionFailed
+			results[i].Reason = errs[i].Error()
+		}
+	}
+	return results
+}
+
+//Gets results of steps not applied for the reason
+func skippedSteps(plan MergePlan, reason string) []StepResult {
+	results := make([]StepResult, len(plan.Steps))
+	for i, step := range plan.Steps {
+		results[i] = StepResult{Action: step.Action, SrcPath: step.SrcPath, DstPath: step.DstPath, Status: ActionSkipped, Reason: reason}
+	}
+	return results
+}
+
+//Gets status of file merge from results of its steps
+func fileStatus(steps []StepResult) ActionStatus {
+	for _, step := range steps {
+		if step.Status == ActionFailed {
+			return ActionFailed
+		}
+	}
+	return ActionApplied
+}
+
+//Adds steps applied after merge of the file to its result, resulting document is kept for dry run
+func (mr * MergeReport) addSteps(fileKey string, fileExt string, steps []StepResult, doc map[string]interface{}, isDryRun bool) {
+	var result *MergeResult
+	for i := range mr.Files {
+		if mr.Files[i].FileKey == fileKey && mr.Files[i].FileExt == fileExt {
+			result = &mr.Files[i]
+			break
+		}
+	}
+
+	if result == nil {
+		mr.Files = append(mr.Files, MergeResult{FileKey: fileKey, FileExt: fileExt, Status: ActionSkipped})
+		result = &mr.Files[len(mr.Files) - 1]
+	}
+
+	result.Steps = append(result.Steps, steps...)
+	if result.Status != ActionFailed && len(result.Steps) > 0 {
+		result.Status = fileStatus(result.Steps)
+		result.Reason = ""
+	}
+
+	if isDryRun {
+		result.Document = doc
+	}
+}
+
+//Checks whether any file or step of the merge failed
+func (mr * MergeReport) HasFailures() bool {
+	for _, file := range mr.Files {
+		if file.Status == ActionFailed {
+			return true
+		}
+	}
+	return false
+}
+
+//Gets number of steps with given status
+func (mr * MergeReport) Count(status ActionStatus) int {
+	count := 0
+	for _, file := range mr.Files {
+		for _, step := range file.Steps {
+			if step.Status == status {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+//Gets descriptions of failed files and steps
+func (mr * MergeReport) Failures() []string {
+	failures := make([]string, 0)
+	for _, file := range mr.Files {
+		if file.Status != ActionFailed {
+			continue
+		}
+		if file.Reason != "" {
+			failures = append(failures, fmt.Sprintf("%v%v: %v", file.FileKey, file.FileExt, file.Reason))
+		}
+		for _, step := range file.Steps {
+			if step.Status == ActionFailed {
+				path := step.SrcPath
+				if path == "" {
+					path = step.DstPath
+				}
+				failures = append(failures, fmt.Sprintf("%v%v: %v: %v", file.FileKey, file.FileExt, path, step.Reason))
+			}
+		}
+	}
+	return failures
+}
@@ -0,0 +1,303 @@
+package sketchmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+)
+
+//Rule selecting nodes of compared documents matching all of its non empty conditions
+//Node selected by rule is selected with its whole subtree
+type CompareRule struct {
+	//name of the property, e.g. userInfo
+	Key string `json:"key,omitempty"`
+	//jsonpath pattern of the node, e.g. $..exportOptions or $["layers"][*]["userInfo"]
+	Path string `json:"path,omitempty"`
+	//_class of the node, e.g. MSImmutableForeignSymbol
+	Class string `json:"class,omitempty"`
+}
+
+//State of compared node according to include and exclude rules
+type nodeState uint8
+
+const (
+	//node is compared with its subtree
+	nodeCompared nodeState = iota
+	//node is skipped with its subtree
+	nodeExcluded
+	//node opens included subtree
+	nodeIncluded
+	//node isn't included, only its subtree is searched for included nodes
+	nodePassed
+)
+
+//Include and exclude rules with path patterns expanded against compared documents
+type compareFilter struct {
+	include []CompareRule
+	exclude []CompareRule
+
+	//paths of nodes of doc1 and doc2 selected by path patterns of the rules, in configured path format
+	includePaths [][2]map[string]bool
+	excludePaths [][2]map[string]bool
+
+	//number of included nodes on the path of compared node
+	included int
+}
+
+//Reads comparison options with include and exclude rules from json file
+func LoadCompareOptions(configFile string) (CompareOptions, error) {
+	var options CompareOptions
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return options, err
+	}
+
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&options); err != nil {
+		return options, err
+	}
+
+	for _, rules := range [][]CompareRule{options.Include, options.Exclude} {
+		for _, rule := range rules {
+			if rule.Path == "" {
+				continue
+			}
+			if _, err := ParsePath(rule.Path); err != nil {
+				return options, err
+			}
+		}
+	}
+
+	return options, nil
+}
+
+//Builds filter of include and exclude rules for doc1 and doc2, nil if there are no rules
+func (jsc * JsonStructureCompare) newCompareFilter(doc1 map[string]interface{}, doc2 map[string]interface{}, path string) *compareFilter {
+	if len(jsc.Options.Include) == 0 && len(jsc.Options.Exclude) == 0 {
+		return nil
+	}
+
+	return &compareFilter{
+		include: jsc.Options.Include,
+		exclude: jsc.Options.Exclude,
+		includePaths: jsc.rulePaths(jsc.Options.Include, doc1, doc2, path),
+		excludePaths: jsc.rulePaths(jsc.Options.Exclude, doc1, doc2, path),
+	}
+}
+
+//Gets paths of nodes of doc1 and doc2 selected by path patterns of rules
+func (jsc * JsonStructureCompare) rulePaths(rules []CompareRule, doc1 map[string]interface{}, doc2 map[string]interface{}, path string) [][2]map[string]bool {
+	paths := make([][2]map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Path != "" {
+			paths[i] = jsc.patternPaths(rule.Path, doc1, doc2, path)
+		}
+	}
+	return paths
+}
+
+//Gets paths of nodes of doc1 and doc2 selected by jsonpath pattern, in configured path format
+func (jsc * JsonStructureCompare) patternPaths(pattern string, doc1 map[string]interface{}, doc2 map[string]interface{}, path string) [2]map[string]bool {
+	var paths [2]map[string]bool
+	for doc, root := range []map[string]interface{}{doc1, doc2} {
+		paths[doc] = make(map[string]bool)
+
+		expanded, err := ExpandJSONPath(root, pattern)
+		if err != nil {
+			continue
+		}
+
+		for _, concrete := range expanded {
+			if formatted, ok := jsc.formatPath(root, concrete, path); ok {
+				paths[doc][formatted] = true
+			}
+		}
+	}
+	return paths
+}
+
+//Builds path of the node selected by concrete jsonpath in configured path format
+func (jsc * JsonStructureCompare) formatPath(doc map[string]interface{}, jsonPath string, root string) (string, bool) {
+	p, err := ParsePath(jsonPath)
+	if err != nil {
+		return "", false
+	}
+
+	formatted := jsc.rootPath(root)
+	var v interface{} = doc
+	for i := 0; i < p.Len(); i++ {
+		matches, err := selectChildren(p.Segment(i), v)
+		if err != nil || len(matches) == 0 {
+			return "", false
+		}
+		formatted = jsc.childPath(formatted, v, matches[0].Key)
+		v = matches[0].Value
+	}
+	return formatted, true
+}
+
+//Builds path of child of container by its key or index in configured path format
+func (jsc * JsonStructureCompare) childPath(path string, container interface{}, key interface{}) string {
+	switch childKey := key.(type) {
+	case int:
+		treeArray, _ := container.([]interface{})
+		return jsc.elementPath(path, treeArray, childKey)
+	case string:
+		return jsc.keyPath(path, childKey)
+	}
+	return path
+}
+
+//Checks whether rule matches node with given property name and value, paths are nodes selected by path pattern
+func (rule *CompareRule) matches(key string, value interface{}, path string, paths map[string]bool) bool {
+	if rule.Key != "" && rule.Key != key {
+		return false
+	}
+
+	if rule.Class != "" {
+		valueMap, _ := value.(map[string]interface{})
+		if class, _ := valueMap["_class"].(string); class != rule.Class {
+			return false
+		}
+	}
+
+	if rule.Path != "" && !paths[path] {
+		return false
+	}
+
+	return true
+}
+
+//Checks whether any of rules matches node of doc1 (0) or doc2 (1)
+func matchesNode(rules []CompareRule, paths [][2]map[string]bool, doc int, key string, value interface{}, path string) bool {
+	for i := range rules {
+		if rules[i].matches(key, value, path, paths[i][doc]) {
+			return true
+		}
+	}
+	return false
+}
+
+//Gets state of child of compared containers, key is empty for array elements, path of missing child is empty
+func (filter *compareFilter) state(key string, value1 interface{}, value2 interface{}, path1 string, path2 string) nodeState {
+	if filter == nil {
+		return nodeCompared
+	}
+
+	if (path1 != "" && matchesNode(filter.exclude, filter.excludePaths, 0, key, value1, path1)) ||
+		(path2 != "" && matchesNode(filter.exclude, filter.excludePaths, 1, key, value2, path2)) {
+		return nodeExcluded
+	}
+
+	if len(filter.include) == 0 || filter.included > 0 {
+		return nodeCompared
+	}
+
+	if (path1 != "" && matchesNode(filter.include, filter.includePaths, 0, key, value1, path1)) ||
+		(path2 != "" && matchesNode(filter.include, filter.includePaths, 1, key, value2, path2)) {
+		return nodeIncluded
+	}
+
+	return nodePassed
+}
+
+//Checks whether differences of the node are recorded
+func (state nodeState) isCompared() bool {
+	return state == nodeCompared || state == nodeIncluded
+}
+
+//Compares children of containers in the state given by include and exclude rules
+func (jsc * JsonStructureCompare) compareChild(state nodeState, doc1 *interface{}, doc2 *interface{}, pathDoc1 string, pathDoc2 string) (string, string, bool) {
+	switch state {
+	case nodeExcluded:
+		return pathDoc1, pathDoc2, true
+	case nodePassed:
+		//only containers of the same type may have included children
+		_, isDoc1Map := (*doc1).(map[string]interface{})
+		_, isDoc2Map := (*doc2).(map[string]interface{})
+		_, isDoc1Array := (*doc1).([]interface{})
+		_, isDoc2Array := (*doc2).([]interface{})
+		if !(isDoc1Map && isDoc2Map) && !(isDoc1Array && isDoc2Array) {
+			return pathDoc1, pathDoc2, true
+		}
+	case nodeIncluded:
+		jsc.filter.included++
+		defer func() { jsc.filter.included-- }()
+	}
+	return jsc.CompareDocuments(doc1, doc2, pathDoc1, pathDoc2)
+}
+
+//Checks whether node at path of doc1 (0) or doc2 (1) is compared according to rules matching the nodes along the path
+func (jsc * JsonStructureCompare) selectsPath(filter *compareFilter, doc int, root map[string]interface{}, path string) bool {
+	p, err := ParsePath(path)
+	if err != nil {
+		return true
+	}
+
+	isIncluded := len(filter.include) == 0
+	formatted := jsc.rootPath("$")
+	var v interface{} = root
+	for i := 0; i < p.Len(); i++ {
+		matches, err := selectChildren(p.Segment(i), v)
+		if err != nil || len(matches) == 0 {
+			break
+		}
+
+		formatted = jsc.childPath(formatted, v, matches[0].Key)
+		v = matches[0].Value
+		key, _ := matches[0].Key.(string)
+
+		if matchesNode(filter.exclude, filter.excludePaths, doc, key, v, formatted) {
+			return false
+		}
+		if !isIncluded && matchesNode(filter.include, filter.includePaths, doc, key, v, formatted) {
+			isIncluded = true
+		}
+	}
+	return isIncluded
+}
+
+//Moves differences of nodes skipped by include and exclude rules out of src to dst differences
+//Removed differences are given as separate comparison
+func (jsc * JsonStructureCompare) filterDiffs(doc1 map[string]interface{}, doc2 map[string]interface{}) *JsonStructureCompare {
+	excluded := NewJsonStructureCompare()
+	excluded.ObjectKeyName = jsc.ObjectKeyName
+
+	filter := jsc.newCompareFilter(doc1, doc2, "$")
+	if filter == nil {
+		return excluded
+	}
+
+	for key, item := range jsc.Doc1Diffs {
+		var isSelected bool
+		switch {
+		case isAddDiff(key):
+			isSelected = jsc.selectsPath(filter, 0, doc1, key)
+		case isDeleteDiff(key):
+			isSelected = jsc.selectsPath(filter, 1, doc2, key)
+		default:
+			isSelected = jsc.selectsPath(filter, 0, doc1, key) && jsc.selectsPath(filter, 1, doc2, toString(item))
+		}
+
+		if !isSelected {
+			excluded.Doc1Diffs[key] = item
+			delete(jsc.Doc1Diffs, key)
+		}
+	}
+
+	for key, item := range jsc.Doc1SeqDiffs {
+		if !jsc.selectsPath(filter, 0, doc1, key) || !jsc.selectsPath(filter, 1, doc2, toString(item)) {
+			excluded.Doc1SeqDiffs[key] = item
+			delete(jsc.Doc1SeqDiffs, key)
+		}
+	}
+
+	for key, item := range jsc.Doc1MoveDiffs {
+		if !jsc.selectsPath(filter, 0, doc1, key) || !jsc.selectsPath(filter, 1, doc2, toString(item)) {
+			excluded.Doc1MoveDiffs[key] = item
+			delete(jsc.Doc1MoveDiffs, key)
+		}
+	}
+
+	return excluded
+}
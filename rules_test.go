@@ -0,0 +1,115 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedDiffKeys(diffs map[string]interface{}) []string {
+	keys := make([]string, 0, len(diffs))
+	for key := range diffs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestJsonStructureCompare_Rules(t *testing.T) {
+	doc1 := `{"created": {"build": 1}, "userInfo": {"a": 1}, "name": "new", "layers": [
+		{"do_objectID": "A", "_class": "text", "name": "a", "userInfo": {"b": 1}},
+		{"do_objectID": "F", "_class": "MSImmutableForeignSymbol", "name": "f"},
+		{"do_objectID": "N", "_class": "text", "name": "added"}],
+		"points": [{"x": 1}, {"x": 2}]}`
+	doc2 := `{"created": {"build": 2}, "name": "old", "layers": [
+		{"do_objectID": "A", "_class": "text", "name": "b", "userInfo": {"b": 2}},
+		{"do_objectID": "F", "_class": "MSImmutableForeignSymbol", "name": "g"}],
+		"points": [{"x": 1}, {"x": 3}]}`
+
+	cases := []struct {
+		options CompareOptions
+		expected []string
+	}{
+		{CompareOptions{}, []string{`$["created"]["build"]`, `$["layers"][0]["name"]`, `$["layers"][0]["userInfo"]["b"]`,
+			`$["layers"][1]["name"]`, `$["name"]`, `$["points"]`, `$["points"][1]["x"]`, `+$["layers"][2]`, `+$["userInfo"]`}},
+		{CompareOptions{Exclude: []CompareRule{{Key: "userInfo"}, {Path: `$["created"]`}, {Class: "MSImmutableForeignSymbol"}, {Path: `$["points"][1]`}}},
+			[]string{`$["layers"][0]["name"]`, `$["name"]`, `+$["layers"][2]`}},
+		{CompareOptions{Include: []CompareRule{{Path: `$["layers"][*]`}}, Exclude: []CompareRule{{Key: "userInfo"}}},
+			[]string{`$["layers"][0]["name"]`, `$["layers"][1]["name"]`, `+$["layers"][2]`}},
+		{CompareOptions{Include: []CompareRule{{Key: "name"}, {Class: "text"}}},
+			[]string{`$["layers"][0]["name"]`, `$["layers"][0]["userInfo"]["b"]`, `$["layers"][1]["name"]`, `$["name"]`, `+$["layers"][2]`}},
+	}
+
+	for _, c := range cases {
+		var jsonDoc1, jsonDoc2 map[string]interface{}
+		err1 := json.Unmarshal([]byte(doc1), &jsonDoc1)
+		err2 := json.Unmarshal([]byte(doc2), &jsonDoc2)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("Error occured %v %v", err1, err2)
+		}
+
+		jsCompare := NewJsonStructureCompare()
+		jsCompare.Options = c.options
+		jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+		if keys := sortedDiffKeys(jsCompare.Doc1Diffs); !reflect.DeepEqual(keys, c.expected) {
+			t.Errorf("Expected differences %v for %+v, got %v", c.expected, c.options, keys)
+		}
+	}
+}
+
+func TestProcessFileMerge_Rules(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	writeTestFiles(t, srcDir, map[string]string{
+		"document.json": `{"name": "new", "userInfo": {"a": 1}, "layers": [{"do_objectID": "A", "userInfo": {"b": 1}}]}`,
+		"config.json": `{"exclude": [{"key": "userInfo"}]}`,
+	})
+	writeTestFiles(t, dstDir, map[string]string{
+		"document.json": `{"name": "old", "layers": [{"do_objectID": "A", "userInfo": {"b": 2}}]}`,
+	})
+
+	mergeInfo := `{"merge_actions": [{"file_key": "document", "file_ext": ".json", "file_diff": {"src_to_dst_diff": {
+		"$[\"name\"]": "$[\"name\"]",
+		"+$[\"userInfo\"]": "$",
+		"$[\"layers\"][0][\"userInfo\"][\"b\"]": "$[\"layers\"][0][\"userInfo\"][\"b\"]"}}}]}`
+	mergeFile := filepath.Join(srcDir, "merge.json")
+	if err := ioutil.WriteFile(mergeFile, []byte(mergeInfo), 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	options, err := LoadCompareOptions(filepath.Join(srcDir, "config.json"))
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{DryRun: true, Compare: options})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if report.Count(ActionApplied) != 1 || report.Count(ActionSkipped) != 2 {
+		t.Errorf("Expected excluded differences skipped, got %v", report.Files)
+	}
+
+	expected := map[string]interface{}{"name": "new", "layers": []interface{}{
+		map[string]interface{}{"do_objectID": "A", "userInfo": map[string]interface{}{"b": json.Number("2")}},
+	}}
+	if len(report.Files) != 1 || !reflect.DeepEqual(report.Files[0].Document, expected) {
+		t.Errorf("Expected merged document without excluded keys, got %v", report.Files)
+	}
+}
@@ -0,0 +1,437 @@
+package sketchmerge
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var PatternPathMismatch = errors.New("Src and dst patterns don't select the same nodes.")
+
+//Child of json value selected by node
+type nodeMatch struct {
+	//key of the child in map or index of the child in array
+	Key interface{}
+	Value interface{}
+}
+
+//Pattern node bound to one of its matches, passed to events and returned instead of the shared pattern node
+type matchedNode struct {
+	Node
+	//key of the match in map or index of the match in array
+	Key interface{}
+}
+
+func (m *matchedNode) GetKey() interface{} {
+	return m.Key
+}
+
+//Selects all elements of array or all properties of map, e.g. [*]
+type WildcardSelection struct {
+	RootNode
+}
+
+func (w *WildcardSelection) Apply(v interface{}) (interface{}, Node, error) {
+	return w.ApplyWithEvent(v, nil)
+}
+
+func (w *WildcardSelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
+	matches, err := selectChildren(w, v)
+	if err != nil {
+		return v, w, err
+	}
+	return applyMatches(w, matches, e)
+}
+
+//Gets nil, keys of matches are given by nodes passed to events
+func (w *WildcardSelection) GetKey() interface{} {
+	return nil
+}
+
+//Selects elements of array in range [start:end], negative bounds are counted from the end of array
+type SliceSelection struct {
+	Start int
+	End int
+	HasStart bool
+	HasEnd bool
+	RootNode
+}
+
+func (sl *SliceSelection) Apply(v interface{}) (interface{}, Node, error) {
+	return sl.ApplyWithEvent(v, nil)
+}
+
+func (sl *SliceSelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
+	matches, err := selectChildren(sl, v)
+	if err != nil {
+		return v, sl, err
+	}
+	return applyMatches(sl, matches, e)
+}
+
+//Gets nil, indices of matches are given by nodes passed to events
+func (sl *SliceSelection) GetKey() interface{} {
+	return nil
+}
+
+//Gets bounds of the slice for array of given length
+func (sl *SliceSelection) bounds(length int) (int, int) {
+	start, end := 0, length
+	if sl.HasStart {
+		start = clampIndex(sl.Start, length)
+	}
+	if sl.HasEnd {
+		end = clampIndex(sl.End, length)
+	}
+	return start, end
+}
+
+func clampIndex(index int, length int) int {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
+
+//Selects properties with given name at any depth, e.g. ..["style"]
+type RecursiveSelection struct {
+	Key string
+	RootNode
+}
+
+func (r *RecursiveSelection) Apply(v interface{}) (interface{}, Node, error) {
+	return r.ApplyWithEvent(v, nil)
+}
+
+func (r *RecursiveSelection) ApplyWithEvent(v interface{}, e NodeEvent) (interface{}, Node, error) {
+	matches, err := selectChildren(r, v)
+	if err != nil {
+		return v, r, err
+	}
+	return applyMatches(r, matches, e)
+}
+
+func (r *RecursiveSelection) GetKey() interface{} {
+	return r.Key
+}
+
+//Collects values of properties named key in v and all its descendants in document order
+func collectRecursive(key string, v interface{}, matches []nodeMatch) []nodeMatch {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if child, ok := value[key]; ok {
+			matches = append(matches, nodeMatch{key, child})
+		}
+		for _, childKey := range sortedKeys(value) {
+			matches = collectRecursive(key, value[childKey], matches)
+		}
+	case []interface{}:
+		for _, child := range value {
+			matches = collectRecursive(key, child, matches)
+		}
+	}
+	return matches
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Passes every match to the next nodes and returns the first one found
+//Events get the match bound to the pattern node, the pattern node itself is never changed
+func applyMatches(node Node, matches []nodeMatch, e NodeEvent) (interface{}, Node, error) {
+	var result interface{}
+	var resultNode Node
+	found := false
+
+	for _, match := range matches {
+		matched := &matchedNode{node, match.Key}
+		if e != nil && !e(match.Value, node.GetPrev(), matched) {
+			if !found {
+				result, resultNode, found = match.Value, matched, true
+			}
+			continue
+		}
+
+		value, lastNode, err := applyNext(node.GetNext(), matched, match.Value, matchedEvent(node, matched, e))
+		if err == nil && !found {
+			result, resultNode, found = value, lastNode, true
+		}
+	}
+
+	if !found {
+		return nil, node, NotFound
+	}
+	return result, resultNode, nil
+}
+
+//Wraps event so the next nodes get the match as their previous node instead of the pattern node
+func matchedEvent(node Node, matched *matchedNode, e NodeEvent) NodeEvent {
+	if e == nil {
+		return nil
+	}
+	return func(v interface{}, prevNode Node, nextNode Node) bool {
+		if prevNode == node {
+			prevNode = matched
+		}
+		return e(v, prevNode, nextNode)
+	}
+}
+
+//Gets children of v selected by single node
+func selectChildren(node Node, v interface{}) ([]nodeMatch, error) {
+	switch sel := node.(type) {
+	case *MapSelection:
+		mv, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, MapTypeError
+		}
+		child, ok := mv[sel.Key]
+		if !ok {
+			return nil, NotFound
+		}
+		return []nodeMatch{{sel.Key, child}}, nil
+	case *ArraySelection, *ObjectIDSelection:
+		if key, isMapKey := mapKey(sel, v); isMapKey {
+			child, ok := v.(map[string]interface{})[key]
+			if !ok {
+				return nil, NotFound
+			}
+			return []nodeMatch{{key, child}}, nil
+		}
+		arv, ok := v.([]interface{})
+		if !ok {
+			return nil, ArrayTypeError
+		}
+		index, err := arrayIndex(sel, arv)
+		if err != nil {
+			return nil, err
+		}
+		return []nodeMatch{{index, arv[index]}}, nil
+	case *WildcardSelection:
+		switch value := v.(type) {
+		case []interface{}:
+			matches := make([]nodeMatch, 0, len(value))
+			for index, child := range value {
+				matches = append(matches, nodeMatch{index, child})
+			}
+			return matches, nil
+		case map[string]interface{}:
+			matches := make([]nodeMatch, 0, len(value))
+			for _, key := range sortedKeys(value) {
+				matches = append(matches, nodeMatch{key, value[key]})
+			}
+			return matches, nil
+		}
+		return nil, ArrayTypeError
+	case *SliceSelection:
+		arv, ok := v.([]interface{})
+		if !ok {
+			return nil, ArrayTypeError
+		}
+		start, end := sel.bounds(len(arv))
+		matches := make([]nodeMatch, 0)
+		for index := start; index < end; index++ {
+			matches = append(matches, nodeMatch{index, arv[index]})
+		}
+		return matches, nil
+	case *FilterSelection:
+		return sel.selectMatches(v)
+	case *RecursiveSelection:
+		return collectRecursive(sel.Key, v, make([]nodeMatch, 0)), nil
+	}
+	return nil, SyntaxError
+}
+
+//Parses node following .. in jsonpath
+func getRecursiveNode(s string) (Node, string, error) {
+	nn, rs, err := getNode(s)
+	if err != nil {
+		return nil, rs, err
+	}
+
+	mapNode, ok := nn.(*MapSelection)
+	if !ok {
+		return nil, rs, SyntaxError
+	}
+
+	return &RecursiveSelection{Key: mapNode.Key}, rs, nil
+}
+
+//Parses array slice [start:end]
+func getSliceNode(s string) (Node, error) {
+	bounds := strings.Split(s, ":")
+	if len(bounds) != 2 {
+		return nil, SyntaxError
+	}
+
+	slice := &SliceSelection{}
+	var err error
+	if bounds[0] != "" {
+		slice.HasStart = true
+		if slice.Start, err = strconv.Atoi(bounds[0]); err != nil {
+			return nil, SyntaxError
+		}
+	}
+	if bounds[1] != "" {
+		slice.HasEnd = true
+		if slice.End, err = strconv.Atoi(bounds[1]); err != nil {
+			return nil, SyntaxError
+		}
+	}
+	return slice, nil
+}
+
+//Checks whether jsonpath may select several nodes
+func IsPattern(path string) bool {
+	p, err := ParsePath(path)
+	return err == nil && p.IsPattern()
+}
+
+//Expands jsonpath with wildcard, slice, recursive and filter selectors into paths of all matching nodes of doc
+//Action prefix of path is kept in the expanded paths
+func ExpandJSONPath(doc map[string]interface{}, path string) ([]string, error) {
+	sel, action, err := Parse(path)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := "$"
+	switch action {
+	case ValueAdd:
+		prefix = "+$"
+	case ValueDelete:
+		prefix = "-$"
+	}
+
+	return expandNode(sel.GetNext(), doc, prefix, make([]string, 0)), nil
+}
+
+func expandNode(node Node, v interface{}, path string, paths []string) []string {
+	if node == nil {
+		return append(paths, path)
+	}
+
+	if recursive, ok := node.(*RecursiveSelection); ok {
+		return expandRecursive(recursive, v, path, paths)
+	}
+
+	matches, err := selectChildren(node, v)
+	if err != nil {
+		return paths
+	}
+
+	for _, match := range matches {
+		paths = expandNode(node.GetNext(), match.Value, path + keySegment(match.Key), paths)
+	}
+	return paths
+}
+
+func expandRecursive(node *RecursiveSelection, v interface{}, path string, paths []string) []string {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if child, ok := value[node.Key]; ok {
+			paths = expandNode(node.GetNext(), child, path + keySegment(node.Key), paths)
+		}
+		for _, key := range sortedKeys(value) {
+			paths = expandRecursive(node, value[key], path + keySegment(key), paths)
+		}
+	case []interface{}:
+		for index, child := range value {
+			paths = expandRecursive(node, child, path + keySegment(index), paths)
+		}
+	}
+	return paths
+}
+
+//Builds jsonpath segment of map key or array index
+func keySegment(key interface{}) string {
+	switch k := key.(type) {
+	case int:
+		return IndexSegment(k)
+	case string:
+		return KeySegment(k)
+	}
+	return ""
+}
+
+//Merges every node matching jsonpath pattern, patterns select the same nodes in both documents
+//Dst of src pattern has to be the same pattern, or the pattern of parents for adds
+func (md * MergeDocuments) mergeByPattern(srcPath string, dstPath string) error {
+	if srcPath == "" {
+		dstPaths, err := ExpandJSONPath(md.DstDocument, dstPath)
+		if err != nil {
+			return err
+		}
+
+		//delete starting from the end of arrays so indices stay valid
+		sort.Slice(dstPaths, func(i, j int) bool {
+			return lessPath(dstPaths[j], dstPaths[i])
+		})
+
+		for _, path := range dstPaths {
+			if err := md.MergeByJSONPath("", path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := checkPatternDst(srcPath, dstPath); err != nil {
+		return err
+	}
+
+	srcPaths, err := ExpandJSONPath(md.SrcDocument, srcPath)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range srcPaths {
+		dst := path
+		if path[0] == '+' {
+			p, err := ParsePath(path)
+			if err != nil {
+				return err
+			}
+			dst = p.Parent().String()
+		}
+
+		if err := md.MergeByJSONPath(path, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Checks that dst path selects the nodes of src pattern, dst paths of the matches are derived from src paths
+func checkPatternDst(srcPath string, dstPath string) error {
+	src, err := ParsePath(srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := ParsePath(dstPath)
+	if err != nil {
+		return err
+	}
+
+	expected := src.WithAction(ValueChange)
+	if src.Action() == ValueAdd {
+		expected = expected.Parent()
+	}
+	if dst.WithAction(ValueChange).String() != expected.String() {
+		return PatternPathMismatch
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const selectionTestDoc = `{"layers":[
+		{"do_objectID": "BE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test1", "style": {"fills": [{"color": "red"}]}},
+		{"do_objectID": "FE4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test2", "layers": [
+			{"do_objectID": "1E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test3", "style": {"fills": [{"color": "blue"}]}}
+		]},
+		{"do_objectID": "2E4C0CBB-05E4-4D6D-9B75-A8A3ACB36CBA", "name": "test4"}
+	]}`
+
+func TestExpandJSONPath(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(selectionTestDoc), &doc); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	tests := map[string][]string{
+		`$..["style"]["fills"]`: {`$["layers"][0]["style"]["fills"]`, `$["layers"][1]["layers"][0]["style"]["fills"]`},
+		`$..style.fills`: {`$["layers"][0]["style"]["fills"]`, `$["layers"][1]["layers"][0]["style"]["fills"]`},
+		`$["layers"][*]["name"]`: {`$["layers"][0]["name"]`, `$["layers"][1]["name"]`, `$["layers"][2]["name"]`},
+		`$["layers"][1:]["name"]`: {`$["layers"][1]["name"]`, `$["layers"][2]["name"]`},
+		`$["layers"][:-2]["name"]`: {`$["layers"][0]["name"]`},
+		`$["layers"][-1]["name"]`: {`$["layers"][2]["name"]`},
+		`-$["layers"][*]["style"]`: {`-$["layers"][0]["style"]`},
+	}
+
+	for path, expected := range tests {
+		paths, err := ExpandJSONPath(doc, path)
+		if err != nil {
+			t.Errorf("Expand %v failed: %v", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expand %v: expected %v, got %v", path, expected, paths)
+		}
+	}
+}
+
+func TestWildcardSelection_ApplyWithEvent(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(selectionTestDoc), &doc); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	sel, _, err := Parse(`$["layers"][*]["name"]`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	names := make([]interface{}, 0)
+	sel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
+		if node.GetNext() == nil {
+			names = append(names, v)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(names, []interface{}{"test1", "test2", "test4"}) {
+		t.Errorf("Unexpected matches %v", names)
+	}
+
+	if value, _, err := sel.Apply(doc); err != nil || value != "test1" {
+		t.Errorf("Expected first match test1, got %v %v", value, err)
+	}
+
+	//events get keys of matches, the parsed pattern stays unchanged
+	keys := make([]interface{}, 0)
+	sel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
+		if node.GetNext() == nil {
+			keys = append(keys, prevNode.GetKey())
+		}
+		return true
+	})
+	if !reflect.DeepEqual(keys, []interface{}{0, 1, 2}) {
+		t.Errorf("Unexpected keys of matches %v", keys)
+	}
+	if key := sel.GetNext().GetNext().GetKey(); key != nil {
+		t.Errorf("Expected pattern node without key, got %v", key)
+	}
+
+	sel, _, _ = Parse(`$["layers"][1:]`)
+	if _, lastNode, err := sel.Apply(doc); err != nil || lastNode.GetKey() != 1 {
+		t.Errorf("Expected first match at index 1, got %v %v", lastNode.GetKey(), err)
+	}
+
+	sel, _, _ = Parse(`$..["missing"]`)
+	if _, _, err := sel.Apply(doc); err != NotFound {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+}
+
+func TestMergeDocuments_MergeByPattern(t *testing.T) {
+	var src, dst map[string]interface{}
+	err1 := json.Unmarshal([]byte(selectionTestDoc), &src)
+	err2 := json.Unmarshal([]byte(selectionTestDoc), &dst)
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	src["layers"].([]interface{})[0].(map[string]interface{})["style"].(map[string]interface{})["fills"] = []interface{}{}
+
+	mergeDoc := MergeDocuments{src, dst}
+	if err := mergeDoc.MergeByJSONPath(`$..["style"]["fills"]`, `$..["style"]["fills"]`); err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	layers := dst["layers"].([]interface{})
+	if fills := layers[0].(map[string]interface{})["style"].(map[string]interface{})["fills"]; len(fills.([]interface{})) != 0 {
+		t.Errorf("Expected fills to be merged, got %v", fills)
+	}
+
+	//pattern selects several nodes, so it can't be merged into a single dst node
+	if err := mergeDoc.MergeByJSONPath(`$["layers"][*]["name"]`, `$["layers"][0]["name"]`); err != PatternPathMismatch {
+		t.Errorf("Expected pattern mismatch, got %v", err)
+	}
+
+	if err := mergeDoc.MergeByJSONPath("", `-$["layers"][0:2]`); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	layers = dst["layers"].([]interface{})
+	if len(layers) != 1 || layers[0].(map[string]interface{})["name"] != "test4" {
+		t.Errorf("Unexpected layers after delete %v", layers)
+	}
+}
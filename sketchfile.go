@@ -16,14 +16,14 @@ import (
 )
 
 type SketchLayerInfo struct {
-	LayerName string
-	LayerID string
-	ArtboardName string
-	ArtboardID string
-	PageName string
-	PageID string
-	NiceDescriptionShort string
-	NiceDescription string
+	LayerName string `json:"layer_name,omitempty"`
+	LayerID string `json:"layer_id,omitempty"`
+	ArtboardName string `json:"artboard_name,omitempty"`
+	ArtboardID string `json:"artboard_id,omitempty"`
+	PageName string `json:"page_name,omitempty"`
+	PageID string `json:"page_id,omitempty"`
+	NiceDescriptionShort string `json:"-"`
+	NiceDescription string `json:"-"`
 }
 
 type Difference interface {
@@ -104,9 +104,10 @@ func readJSON(docFile string) (map[string]interface{}, error) {
 	return result1, nil
 }
 
-func CompareJSON(doc1File string, doc2File string) (*JsonStructureCompare, error) {
+func CompareJSON(doc1File string, doc2File string, options CompareOptions) (*JsonStructureCompare, error) {
 
 	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options = options
 
 	if _, err := os.Stat(doc1File); os.IsNotExist(err) {
 		return jsCompare, nil
@@ -293,6 +294,54 @@ func (li * SketchLayerInfo) SetDifference(diff SketchDiff, diffSrc string, diffD
 
 }
 
+//Collects page, artboard and layer owning the node selected by sel in doc
+func getLayerInfo(doc map[string]interface{}, sel Node) (SketchLayerInfo, string, Node, error) {
+	var info SketchLayerInfo
+	var layerPath string = ""
+
+	_, lastNode, err := sel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
+		if prevNode == nil {
+			layer, _ := v.(map[string]interface{})
+			if layer != nil {
+				lname := layer["name"]
+				lid := layer["do_objectID"]
+				if lname == nil || lid == nil {
+					return true
+				}
+
+				info.PageName = lname.(string)
+				info.PageID = lid.(string)
+				layerPath = info.PageName
+
+			}
+		} else if prevNode.GetKey() == "layers" {
+			layer, _ := v.(map[string]interface{})
+			if layer != nil {
+				lname := layer["name"]
+				lid := layer["do_objectID"]
+				if lname == nil || lid == nil {
+					return true
+				}
+
+
+				if layer["_class"] == "artboard" {
+					info.ArtboardName = lname.(string)
+					info.ArtboardID = lid.(string)
+					layerPath += "/" + info.ArtboardName
+				} else  {
+					info.LayerName = lname.(string)
+					info.LayerID = lid.(string)
+					layerPath += "/" + info.LayerName
+				}
+			}
+
+		}
+		return true;
+	})
+
+	return info, layerPath, lastNode, err
+}
+
 func ProduceNiceDiff(doc1 map[string]interface{}, doc2 map[string]interface{}, diff map[string]interface{}, isSeqChange bool) map[string]interface{}  {
 
 	if diff==nil {
@@ -303,65 +352,14 @@ func ProduceNiceDiff(doc1 map[string]interface{}, doc2 map[string]interface{}, d
 	skDiff := SketchDiff{PageDiff: make(map[string]interface{}), MainDiff: MainDiff{Diff:make(map[string]interface{}), Description: make(map[string]string)}}
 
 	for key, item := range diff {
-		var pageID = ""
-		var pageName = ""
-
-		var artboardID = ""
-		var artboardName = ""
-
-		var niceDesc = ""
-		var niceDescShort = ""
-
-		var layerID = ""
-		var layerName string = ""
-		var layerPath string = ""
-
 		srcSel, srcact, _ := Parse(key)
 		doc := doc1
 
-		if item == "" && srcact == ValueDelete {
+		if srcact == ValueDelete {
 			doc = doc2
 		}
 
-		_, lastNode, err := srcSel.ApplyWithEvent(doc, func(v interface{}, prevNode Node, node Node) bool {
-			if prevNode == nil {
-				layer := v.(map[string]interface{})
-				if layer != nil {
-					lname := layer["name"]
-					lid := layer["do_objectID"]
-					if lname == nil || lid == nil {
-						return true
-					}
-
-					pageName = lname.(string)
-					pageID = lid.(string)
-					layerPath = pageName
-
-				}
-			} else if prevNode.GetKey() == "layers" {
-				layer := v.(map[string]interface{})
-				if layer != nil {
-					lname := layer["name"]
-					lid := layer["do_objectID"]
-					if lname == nil || lid == nil {
-						return true
-					}
-
-
-					if layer["_class"] == "artboard" {
-						artboardName = lname.(string)
-						artboardID = lid.(string)
-						layerPath += "/" + artboardName
-					} else  {
-						layerName = lname.(string)
-						layerID = lid.(string)
-						layerPath += "/" + layerName
-					}
-				}
-
-			}
-			return true;
-		})
+		layerInfo, layerPath, lastNode, err := getLayerInfo(doc, srcSel)
 
 		if err!=nil {
 			log.Printf("Error occurired while building nice diff: %v", err)
@@ -370,25 +368,19 @@ func ProduceNiceDiff(doc1 map[string]interface{}, doc2 map[string]interface{}, d
 		if isSeqChange {
 			srcact = SequenceChange
 		}
-		if pageID != "" && artboardID != "" && layerID != "" {
-			niceDescShort, niceDesc = getNiceTextForLayer(srcact, layerName, pageName, artboardName, layerPath)
-		} else if layerID != "" {
-			niceDescShort, niceDesc = getNiceTextForUnknownLayer(srcact, layerName, layerPath)
-		} else if artboardID != "" {
-			niceDescShort, niceDesc = getNiceTextForArtboard(srcact, artboardName, pageName)
-		} else if pageID != "" {
-			niceDescShort, niceDesc = getNiceTextForPage(srcact, pageName)
+		if layerInfo.PageID != "" && layerInfo.ArtboardID != "" && layerInfo.LayerID != "" {
+			layerInfo.NiceDescriptionShort, layerInfo.NiceDescription = getNiceTextForLayer(srcact, layerInfo.LayerName, layerInfo.PageName, layerInfo.ArtboardName, layerPath)
+		} else if layerInfo.LayerID != "" {
+			layerInfo.NiceDescriptionShort, layerInfo.NiceDescription = getNiceTextForUnknownLayer(srcact, layerInfo.LayerName, layerPath)
+		} else if layerInfo.ArtboardID != "" {
+			layerInfo.NiceDescriptionShort, layerInfo.NiceDescription = getNiceTextForArtboard(srcact, layerInfo.ArtboardName, layerInfo.PageName)
+		} else if layerInfo.PageID != "" {
+			layerInfo.NiceDescriptionShort, layerInfo.NiceDescription = getNiceTextForPage(srcact, layerInfo.PageName)
 		} else {
-			niceDescShort, niceDesc = getNiceTextForUnknown(srcact, fmt.Sprintf("%v", lastNode.GetKey()))
+			layerInfo.NiceDescriptionShort, layerInfo.NiceDescription = getNiceTextForUnknown(srcact, fmt.Sprintf("%v", lastNode.GetKey()))
 		}
 
-
-		diff := SketchLayerInfo{layerName, layerID,
-			artboardName, artboardID,
-			pageName, pageID,
-			niceDescShort, niceDesc}
-
-		diff.SetDifference(skDiff, key, item.(string))
+		layerInfo.SetDifference(skDiff, key, item.(string))
 
 	}
 
@@ -400,8 +392,9 @@ func ProduceNiceDiff(doc1 map[string]interface{}, doc2 map[string]interface{}, d
 
 }
 
-func CompareJSONNice(doc1File string, doc2File string) (*JsonStructureCompare, error) {
+func CompareJSONNice(doc1File string, doc2File string, options CompareOptions) (*JsonStructureCompare, error) {
 	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options = options
 
 	if _, err := os.Stat(doc1File); os.IsNotExist(err) {
 		return jsCompare, nil
@@ -438,7 +431,7 @@ func WriteToFile(path string, data []byte) error {
 	return ioutil.WriteFile(path, data, 0755 )
 }
 
-func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool) ([]byte, error) {
+func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool, options CompareOptions) ([]byte, error) {
 
 	isSrcDir := false
 	isDstDir := false
@@ -496,12 +489,14 @@ func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool) ([]b
 
 	fsMerge := new(FileStructureMerge)
 	fsMerge.FileSetChange(baseFileStruct, newFileStruct)
+	fsMerge.LCSMatching = options.LCSMatching
 
 	if !isNice {
 		for i := range fsMerge.MergeActions {
 			//fmt.Printf("ext: %v", filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey)))
-			if filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)) == ".json" {
-				result, err := CompareJSON(workingDirV1 + string(os.PathSeparator) + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt,  workingDirV2 + "/" + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)
+			//files of one set only are copied or removed as a whole
+			if fsMerge.MergeActions[i].Action == MERGE && filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)) == ".json" {
+				result, err := CompareJSON(workingDirV1 + string(os.PathSeparator) + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt,  workingDirV2 + "/" + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt, options)
 				if err != nil {
 					return nil, err
 				}
@@ -509,6 +504,11 @@ func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool) ([]b
 			}
 		}
 
+		if options.DetectMoves {
+			if err := fsMerge.DetectFileMoves(workingDirV1, workingDirV2); err != nil {
+				return nil, err
+			}
+		}
 
 		mergeInfo, _ := json.MarshalIndent(fsMerge, "", "  ")
 
@@ -516,8 +516,8 @@ func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool) ([]b
 	} else {
 		for i := range fsMerge.MergeActions {
 			//fmt.Printf("ext: %v", filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey)))
-			if filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)) == ".json" {
-				result, err := CompareJSONNice(workingDirV1 + string(os.PathSeparator) + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt,  workingDirV2 + "/" + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)
+			if fsMerge.MergeActions[i].Action == MERGE && filepath.Ext(strings.ToLower(fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt)) == ".json" {
+				result, err := CompareJSONNice(workingDirV1 + string(os.PathSeparator) + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt,  workingDirV2 + "/" + fsMerge.MergeActions[i].FileKey + fsMerge.MergeActions[i].FileExt, options)
 				if err != nil {
 					return nil, err
 				}
@@ -525,6 +525,11 @@ func ProcessFileDiff(sketchFileV1 string, sketchFileV2 string, isNice bool) ([]b
 			}
 		}
 
+		if options.DetectMoves {
+			if err := fsMerge.DetectFileMoves(workingDirV1, workingDirV2); err != nil {
+				return nil, err
+			}
+		}
 
 		mergeInfo, _ := json.MarshalIndent(fsMerge, "", "  ")
 
@@ -563,50 +568,87 @@ func decodeMergeFiles(doc1File string, doc2File string) (map[string]interface{},
 	return result1, result2, nil
 }
 
-func mergeActions(workingDirV1 string, workingDirV2 string, mergeJSON FileStructureMerge) error {
+//Options of sketch files merge
+type MergeOptions struct {
+	//apply actions in memory only and give resulting documents in report
+	DryRun bool
+
+	//options of json documents comparison, include and exclude rules filter merged differences
+	//matching of arrays is the one the merge file was made with, LCSMatching is ignored
+	Compare CompareOptions
+}
+
+//Applies merge actions to documents of dst dir and stages resulting files in transaction
+//Dry run gives resulting documents in report
+func mergeActions(workingDirV1 string, workingDirV2 string, mergeJSON FileStructureMerge, tx *fileTransaction, options MergeOptions) (*MergeReport, error) {
+
+	report := &MergeReport{Files: make([]MergeResult, 0, len(mergeJSON.MergeActions))}
 
 	for i := range mergeJSON.MergeActions {
+		if mergeJSON.MergeActions[i].Action == ADD || mergeJSON.MergeActions[i].Action == DELETE {
+			result := mergeFileAction(workingDirV1, workingDirV2, mergeJSON.MergeActions[i], tx)
+			report.Files = append(report.Files, result)
+			continue
+		}
+
+		fileDiff := &mergeJSON.MergeActions[i].FileDiff
+		result := MergeResult{FileKey: mergeJSON.MergeActions[i].FileKey, FileExt: mergeJSON.MergeActions[i].FileExt}
+
+		if len(fileDiff.Doc1Diffs) == 0 && len(fileDiff.Doc1SeqDiffs) == 0 && len(fileDiff.Doc1MoveDiffs) == 0 {
+			result.Status = ActionSkipped
+			result.Reason = "no differences"
+			report.Files = append(report.Files, result)
+			continue
+		}
+
 		srcFilePath := workingDirV1 + string(os.PathSeparator) + mergeJSON.MergeActions[i].FileKey + mergeJSON.MergeActions[i].FileExt
 		dstFilePath := workingDirV2 + string(os.PathSeparator) + mergeJSON.MergeActions[i].FileKey + mergeJSON.MergeActions[i].FileExt
 		jsonDoc1, jsonDoc2, err := decodeMergeFiles(srcFilePath, dstFilePath)
 
 		if err != nil {
+			result.Status = ActionFailed
+			result.Reason = err.Error()
+			report.Files = append(report.Files, result)
 			continue
 		}
 
 		mergeDoc := MergeDocuments{jsonDoc1, jsonDoc2}
 
-		if mergeJSON.MergeActions[i].FileDiff.Doc1Diffs != nil {
-			deleteActions := make(map[string]string)
-			for key, item := range mergeJSON.MergeActions[i].FileDiff.Doc1Diffs {
-				if item == "" {
-					deleteActions[key] = ""
-				} else {
-					mergeDoc.MergeByJSONPath(key, item.(string))
-				}
-			}
+		//differences of nodes skipped by include and exclude rules aren't merged
+		fileDiff.Options = options.Compare
+		fileDiff.Options.LCSMatching = mergeJSON.LCSMatching
+		excluded := fileDiff.filterDiffs(jsonDoc1, jsonDoc2)
 
-			for key, _ := range deleteActions {
-				mergeDoc.MergeByJSONPath("", key)
-			}
+		plan := PlanMerge(fileDiff)
+		result.Steps = stepResults(plan, mergeDoc.ApplyPlan(plan))
+		result.Steps = append(result.Steps, skippedSteps(PlanMerge(excluded), "excluded by compare rules")...)
+		result.Status = fileStatus(result.Steps)
 
-			for key, item := range mergeJSON.MergeActions[i].FileDiff.Doc1SeqDiffs {
-				mergeDoc.MergeSequenceByJSONPath(mergeJSON.MergeActions[i].FileDiff.ObjectKeyName, key, item.(string))
-			}
+		if options.DryRun {
+			result.Document = mergeDoc.DstDocument
+		}
 
-			data, err := json.Marshal(mergeDoc.DstDocument)
+		data, err := json.Marshal(mergeDoc.DstDocument)
 
-			if err != nil {
-				return err
-			}
-
-			WriteToFile(dstFilePath, data)
+		if err != nil {
+			return nil, err
 		}
+
+		tx.Stage(dstFilePath, data)
+		report.Files = append(report.Files, result)
 	}
-	return nil
+
+	replayFileMoves(workingDirV1, workingDirV2, mergeJSON.FileMoves, tx, report, options.DryRun)
+
+	//pages indexes follow the merged page set
+	if err := reconcilePages(workingDirV1, workingDirV2, tx, report, options.DryRun); err != nil {
+		return nil, err
+	}
+	return report, nil
 }
 
-func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 string, outputDir string) error {
+//Merges sketch files using merge file, dry run applies actions in memory only and gives resulting documents
+func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 string, outputDir string, options MergeOptions) (*MergeReport, error) {
 
 	isSrcDir := false
 	isDstDir := false
@@ -614,7 +656,7 @@ func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 st
 	sketchFileV1Info, errv1 := os.Stat(sketchFileV1)
 
 	if errv1 != nil {
-		return errv1
+		return nil, errv1
 	}
 
 	isSrcDir = sketchFileV1Info.IsDir()
@@ -622,14 +664,14 @@ func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 st
 	sketchFileV2Info, errv2 := os.Stat(sketchFileV2)
 
 	if errv2 != nil {
-		return errv2
+		return nil, errv2
 	}
 
 	isDstDir = sketchFileV2Info.IsDir()
 
 	workingDirV1, err1 := prepareWorkingDir(!isSrcDir)
 	if err1!=nil {
-		return err1
+		return nil, err1
 	}
 	defer removeWorkingDir(workingDirV1, isSrcDir)
 
@@ -639,7 +681,7 @@ func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 st
 
 	workingDirV2, err2 := prepareWorkingDir(!isDstDir)
 	if  err2!=nil {
-		return err2
+		return nil, err2
 	}
 	defer removeWorkingDir(workingDirV2, isDstDir)
 
@@ -649,19 +691,19 @@ func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 st
 
 	if !isSrcDir {
 		if err := Unzip(sketchFileV1, workingDirV1); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if !isDstDir {
 		if err := Unzip(sketchFileV2, workingDirV2); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	mergeFile, err := ioutil.ReadFile(mergeFileName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var mergeJSON FileStructureMerge
@@ -669,20 +711,40 @@ func ProcessFileMerge(mergeFileName string, sketchFileV1 string, sketchFileV2 st
 	decoder.UseNumber()
 
 	if err := decoder.Decode(&mergeJSON); err != nil {
-		return  err
+		return nil, err
+	}
+
+	tx := newFileTransaction()
+
+	report, err := mergeActions(workingDirV1, workingDirV2, mergeJSON, tx, options)
+	if err != nil  {
+		return nil, err
 	}
 
-	if err := mergeActions(workingDirV1, workingDirV2, mergeJSON); err != nil  {
-		return err
+	if options.DryRun {
+		return report, nil
+	}
+
+	//files are written only when every action succeeded
+	if report.HasFailures() {
+		tx.Rollback()
+		report.RolledBack = true
+		return report, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
 	if !isDstDir {
 		sketchFile := outputDir + string(os.PathSeparator) + strings.TrimPrefix(sketchFileV2, filepath.Dir(sketchFileV2))
 		//similar to zip -y -r -q -8 testVCS2.sketch ./pages/ ./previews/ document.json meta.json user.json
-		Zipit(workingDirV2, sketchFile)
+		if err := Zipit(workingDirV2, sketchFile); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return report, nil
 
 }
 
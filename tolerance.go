@@ -0,0 +1,165 @@
+package sketchmerge
+
+import (
+	"math"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Checks whether numeric comparison is configured
+func (opts CompareOptions) hasTolerance() bool {
+	return opts.Tolerance > 0 || len(opts.KeyTolerances) > 0
+}
+
+//Checks whether numbers or sketch points, e.g. "{0.5, 1}", differ less than epsilon configured for the path
+func (jsc * JsonStructureCompare) withinTolerance(v1 interface{}, v2 interface{}, jsonPath string) bool {
+	if !jsc.Options.hasTolerance() {
+		return false
+	}
+
+	nums1, ok1 := numericValues(v1)
+	nums2, ok2 := numericValues(v2)
+	if !ok1 || !ok2 || len(nums1) != len(nums2) {
+		return false
+	}
+
+	epsilon := jsc.tolerance(jsonPath)
+	for i := range nums1 {
+		if math.Abs(nums1[i] - nums2[i]) > epsilon {
+			return false
+		}
+	}
+	return true
+}
+
+//Checks whether values are deeply equal, numbers are compared within tolerance configured for their paths
+func (jsc * JsonStructureCompare) equalValues(v1 interface{}, v2 interface{}, jsonPath string) bool {
+	if fingerprint1, fingerprint2, ok := jsc.fingerprintsOf(v1, v2); ok && (fingerprint1 == fingerprint2 || !jsc.Options.hasTolerance()) {
+		return fingerprint1 == fingerprint2
+	}
+
+	if !jsc.Options.hasTolerance() {
+		return reflect.DeepEqual(v1, v2)
+	}
+
+	switch value1 := v1.(type) {
+	case map[string]interface{}:
+		value2, ok := v2.(map[string]interface{})
+		if !ok || len(value1) != len(value2) {
+			return false
+		}
+		for key, item := range value1 {
+			if subtree, ok := value2[key]; !ok || !jsc.equalValues(item, subtree, jsc.keyPath(jsonPath, key)) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		value2, ok := v2.([]interface{})
+		if !ok || len(value1) != len(value2) {
+			return false
+		}
+		for i := range value1 {
+			if !jsc.equalValues(value1[i], value2[i], jsc.indexPath(jsonPath, i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(v1, v2) || jsc.withinTolerance(v1, v2, jsonPath)
+}
+
+//Gets epsilon of the most specific key pattern matching the path, or global epsilon
+func (jsc * JsonStructureCompare) tolerance(jsonPath string) float64 {
+	if len(jsc.Options.KeyTolerances) == 0 {
+		return jsc.Options.Tolerance
+	}
+
+	keys := pathKeys(jsonPath)
+
+	patterns := make([]string, 0, len(jsc.Options.KeyTolerances))
+	for pattern := range jsc.Options.KeyTolerances {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		ni, nj := strings.Count(patterns[i], "."), strings.Count(patterns[j], ".")
+		if ni != nj {
+			return ni > nj
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		if matchKeyPattern(pattern, keys) {
+			return jsc.Options.KeyTolerances[pattern]
+		}
+	}
+	return jsc.Options.Tolerance
+}
+
+//Gets property names of path, array indices are skipped
+func pathKeys(jsonPath string) []string {
+	p, err := ParsePath(strings.TrimLeft(jsonPath, "+-"))
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, p.Len())
+	for i := 0; i < p.Len(); i++ {
+		switch segment := p.Segment(i).(type) {
+		case *MapSelection:
+			keys = append(keys, segment.Key)
+		case *ArraySelection:
+			//JSON Pointer token of map property
+			if _, err := strconv.Atoi(segment.Token); segment.Token != "" && err != nil {
+				keys = append(keys, segment.Token)
+			}
+		}
+	}
+	return keys
+}
+
+//Checks whether dot separated key pattern matches consecutive keys of the path, e.g. frame.* matches frame.x
+//Pattern also matches everything under the matched keys, e.g. points matches points.point
+func matchKeyPattern(pattern string, keys []string) bool {
+	parts := strings.Split(pattern, ".")
+	for start := 0; start + len(parts) <= len(keys); start++ {
+		matched := true
+		for i, part := range parts {
+			if ok, _ := path.Match(part, keys[start + i]); !ok {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+//Gets number or coordinates of sketch point string as float values
+func numericValues(v interface{}) ([]float64, bool) {
+	if num, ok := toFloat(v); ok {
+		return []float64{num}, true
+	}
+
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, false
+	}
+
+	parts := strings.Split(s[1:len(s) - 1], ",")
+	nums := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		num, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, num)
+	}
+	return nums, true
+}
@@ -0,0 +1,74 @@
+package sketchmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func decodeNumbers(t *testing.T, doc string) map[string]interface{} {
+	var result map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(doc)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	return result
+}
+
+func TestJsonStructureCompare_Tolerance(t *testing.T) {
+	doc1 := `{"frame": {"x": 10, "y": 120.00000000001, "width": 5}, "rotation": 45.04,
+		"points": [{"point": "{0.5, 0.49999999}"}], "opacity": 0.5}`
+	doc2 := `{"frame": {"x": 10.0, "y": 120, "width": 6}, "rotation": 45,
+		"points": [{"point": "{0.5, 0.5}"}], "opacity": 0.50001}`
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Compare(decodeNumbers(t, doc1), decodeNumbers(t, doc2), "$")
+	if len(jsCompare.Doc1Diffs) != 7 {
+		t.Errorf("Expected raw comparison without tolerance, got %v", jsCompare.Doc1Diffs)
+	}
+
+	jsCompare = NewJsonStructureCompare()
+	jsCompare.Options.Tolerance = 0.0001
+	jsCompare.Options.KeyTolerances = map[string]float64{"frame.*": 0.001, "points": 0.01, "rotation": 0.1}
+	jsCompare.Compare(decodeNumbers(t, doc1), decodeNumbers(t, doc2), "$")
+
+	if len(jsCompare.Doc1Diffs) != 1 {
+		t.Fatalf("Expected only change beyond tolerance, got %v", jsCompare.Doc1Diffs)
+	}
+	if _, ok := jsCompare.Doc1Diffs[`$["frame"]["width"]`]; !ok {
+		t.Errorf("Expected width change, got %v", jsCompare.Doc1Diffs)
+	}
+
+	jsCompare = NewJsonStructureCompare()
+	jsCompare.Options.KeyTolerances = map[string]float64{"rotation": 0.01}
+	jsCompare.Compare(decodeNumbers(t, doc1), decodeNumbers(t, doc2), "$")
+
+	//numbers of not matched keys are compared numerically without tolerance
+	if _, ok := jsCompare.Doc1Diffs[`$["frame"]["x"]`]; ok {
+		t.Errorf("Expected 10 and 10.0 to be equal, got %v", jsCompare.Doc1Diffs)
+	}
+	if _, ok := jsCompare.Doc1Diffs[`$["rotation"]`]; !ok {
+		t.Errorf("Expected rotation change beyond tolerance, got %v", jsCompare.Doc1Diffs)
+	}
+}
+
+func TestMatchKeyPattern(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path string
+		isMatch bool
+	}{
+		{"frame.*", `$["layers"][0]["frame"]["x"]`, true},
+		{"frame.*", `$["layers"][0]["frame"]`, false},
+		{"points", `$["layers"][0]["points"][1]["curveFrom"]`, true},
+		{"rotation", `/layers/0/rotation`, true},
+		{"rotation", `$["layers"][0]["frame"]["x"]`, false},
+	}
+
+	for _, c := range cases {
+		if isMatch := matchKeyPattern(c.pattern, pathKeys(c.path)); isMatch != c.isMatch {
+			t.Errorf("Expected match of %v and %v to be %v", c.pattern, c.path, c.isMatch)
+		}
+	}
+}
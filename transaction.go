@@ -0,0 +1,178 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var InvalidStagedFile = errors.New("Staged file is not valid json.")
+
+//Suffixes of temporary files written during commit
+const (
+	stagedFileSuffix = ".merge-staged"
+	backupFileSuffix = ".merge-backup"
+)
+
+//Set of modified and removed files written all at once or not at all
+type fileTransaction struct {
+	paths []string
+	staged map[string][]byte
+	removed []string
+}
+
+func newFileTransaction() *fileTransaction {
+	return &fileTransaction{make([]string, 0), make(map[string][]byte), make([]string, 0)}
+}
+
+//Stages new content of file, nothing is written until commit
+//Staged file is written even if it or its directory was removed before
+func (ft * fileTransaction) Stage(path string, data []byte) {
+	if _, ok := ft.staged[path]; !ok {
+		ft.paths = append(ft.paths, path)
+	}
+	ft.staged[path] = data
+
+	removed := ft.removed[:0]
+	for _, removedPath := range ft.removed {
+		if removedPath != path {
+			removed = append(removed, removedPath)
+		}
+	}
+	ft.removed = removed
+}
+
+//Gets staged content of file
+func (ft * fileTransaction) Staged(path string) ([]byte, bool) {
+	data, ok := ft.staged[path]
+	return data, ok
+}
+
+//Stages removal of file or directory, nothing is removed until commit
+//Files staged before in the removed path are discarded
+func (ft * fileTransaction) Remove(path string) {
+	ft.removed = append(ft.removed, path)
+
+	paths := ft.paths[:0]
+	for _, stagedPath := range ft.paths {
+		if isSubPath(path, stagedPath) {
+			delete(ft.staged, stagedPath)
+		} else {
+			paths = append(paths, stagedPath)
+		}
+	}
+	ft.paths = paths
+}
+
+//Checks whether path is the same as dir or is inside of it
+func isSubPath(dir string, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir + string(os.PathSeparator))
+}
+
+//Checks whether file exists after commit of the transaction
+func (ft * fileTransaction) Exists(path string) bool {
+	if _, ok := ft.staged[path]; ok {
+		return true
+	}
+	for _, removed := range ft.removed {
+		if isSubPath(removed, path) {
+			return false
+		}
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+//Discards all staged files
+func (ft * fileTransaction) Rollback() {
+	ft.paths = ft.paths[:0]
+	ft.staged = make(map[string][]byte)
+	ft.removed = ft.removed[:0]
+}
+
+//Checks that every staged json file is valid json
+func (ft * fileTransaction) Validate() error {
+	for _, path := range ft.paths {
+		if strings.ToLower(filepath.Ext(path)) == ".json" && !json.Valid(ft.staged[path]) {
+			return InvalidStagedFile
+		}
+	}
+	return nil
+}
+
+//Writes all staged files and removes removed ones, either every file gets its new content or all files keep the old one
+//Removed files are moved to backups first, so files staged in removed directories survive,
+//then files are written next to originals and swapped by renames, originals are restored on failure
+func (ft * fileTransaction) Commit() error {
+	if err := ft.Validate(); err != nil {
+		return err
+	}
+
+	backups := make([]string, 0, len(ft.removed) + len(ft.paths))
+	created := make([]string, 0)
+	for _, path := range ft.removed {
+		if err := os.Rename(path, path + backupFileSuffix); err != nil && !os.IsNotExist(err) {
+			ft.restore(backups, created)
+			return err
+		} else if err == nil {
+			backups = append(backups, path)
+		}
+	}
+
+	for _, path := range ft.paths {
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			ft.restore(backups, created)
+			return err
+		}
+		if err := ioutil.WriteFile(path + stagedFileSuffix, ft.staged[path], 0755); err != nil {
+			ft.restore(backups, created)
+			return err
+		}
+	}
+
+	for _, path := range ft.paths {
+		_, err := os.Stat(path)
+		isNew := os.IsNotExist(err)
+
+		if !isNew {
+			if err := os.Rename(path, path + backupFileSuffix); err != nil {
+				ft.restore(backups, created)
+				return err
+			}
+			backups = append(backups, path)
+		}
+
+		if err := os.Rename(path + stagedFileSuffix, path); err != nil {
+			ft.restore(backups, created)
+			return err
+		}
+
+		if isNew {
+			created = append(created, path)
+		}
+	}
+
+	removeFiles(backups, backupFileSuffix)
+	ft.Rollback()
+	return nil
+}
+
+//Restores originals of partially committed files and removes leftovers of the commit
+//Created files go first, so removed directories are restored in place of emptied directories created for them
+func (ft * fileTransaction) restore(backups []string, created []string) {
+	removeFiles(created, "")
+	removeFiles(ft.paths, stagedFileSuffix)
+	for i := len(backups) - 1; i >= 0; i-- {
+		os.Remove(backups[i])
+		os.Rename(backups[i] + backupFileSuffix, backups[i])
+	}
+}
+
+func removeFiles(paths []string, suffix string) {
+	for _, path := range paths {
+		os.RemoveAll(path + suffix)
+	}
+}
@@ -0,0 +1,196 @@
+package sketchmerge
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTransaction_Commit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sketchmerge-tx")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file1 := filepath.Join(dir, "page1.json")
+	file2 := filepath.Join(dir, "page2.json")
+	if err := ioutil.WriteFile(file1, []byte(`{"v": 1}`), 0644); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+
+	tx := newFileTransaction()
+	tx.Stage(file1, []byte(`{"v": 2}`))
+	tx.Stage(file2, []byte(`{"v": 3}`))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if data, _ := ioutil.ReadFile(file1); string(data) != `{"v": 2}` {
+		t.Errorf("Expected committed file1, got %s", data)
+	}
+	if data, _ := ioutil.ReadFile(file2); string(data) != `{"v": 3}` {
+		t.Errorf("Expected committed file2, got %s", data)
+	}
+
+	tx.Stage(file1, []byte(`{"v": 4}`))
+	//parent of the file is a file, so the file can't be written
+	tx.Stage(filepath.Join(file2, "page3.json"), []byte(`{"v": 5}`))
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expected commit to fail")
+	}
+
+	if data, _ := ioutil.ReadFile(file1); string(data) != `{"v": 2}` {
+		t.Errorf("Expected file1 kept after failed commit, got %s", data)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.merge-*"))
+	if len(files) != 0 {
+		t.Errorf("Expected no leftovers of commit, got %v", files)
+	}
+
+	tx.Rollback()
+	tx.Stage(filepath.Join(dir, "images", "image.png"), []byte("png"))
+	tx.Remove(file2)
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if _, err := os.Stat(file2); !os.IsNotExist(err) {
+		t.Errorf("Expected removed file2, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "images", "image.png")); string(data) != "png" {
+		t.Errorf("Expected committed image in new dir, got %s", data)
+	}
+
+	tx.Stage(file1, []byte(`{"v": `))
+	if err := tx.Commit(); err != InvalidStagedFile {
+		t.Errorf("Expected InvalidStagedFile, got %v", err)
+	}
+}
+
+func TestFileTransaction_StageRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sketchmerge-tx")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file1 := filepath.Join(dir, "file1.json")
+	file2 := filepath.Join(dir, "file2.json")
+	pagesDir := filepath.Join(dir, "pages")
+	page1 := filepath.Join(pagesDir, "page1.json")
+	page2 := filepath.Join(pagesDir, "page2.json")
+	if err := os.MkdirAll(pagesDir, os.ModePerm); err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	for _, path := range []string{file1, file2, page1} {
+		if err := ioutil.WriteFile(path, []byte(`{"v": 1}`), 0644); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+	}
+
+	//the last of stage and remove wins
+	tx := newFileTransaction()
+	tx.Stage(file1, []byte(`{"v": 2}`))
+	tx.Remove(file1)
+	tx.Remove(file2)
+	tx.Stage(file2, []byte(`{"v": 3}`))
+	tx.Remove(pagesDir)
+	tx.Stage(page2, []byte(`{"v": 4}`))
+
+	if tx.Exists(file1) || !tx.Exists(file2) || tx.Exists(page1) || !tx.Exists(page2) {
+		t.Errorf("Unexpected files after commit %v %v %v %v", tx.Exists(file1), tx.Exists(file2), tx.Exists(page1), tx.Exists(page2))
+	}
+
+	//commit of removed directory fails after its new file is written, so the directory is restored
+	tx.Stage(filepath.Join(file2, "page3.json"), []byte(`{"v": 5}`))
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expected commit to fail")
+	}
+	if data, _ := ioutil.ReadFile(page1); string(data) != `{"v": 1}` {
+		t.Errorf("Expected page1 restored after failed commit, got %s", data)
+	}
+	if _, err := os.Stat(page2); !os.IsNotExist(err) {
+		t.Errorf("Expected no page2 after failed commit, got %v", err)
+	}
+
+	tx.Rollback()
+	tx.Stage(file1, []byte(`{"v": 2}`))
+	tx.Remove(file1)
+	tx.Remove(file2)
+	tx.Stage(file2, []byte(`{"v": 3}`))
+	tx.Remove(pagesDir)
+	tx.Stage(page2, []byte(`{"v": 4}`))
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if _, err := os.Stat(file1); !os.IsNotExist(err) {
+		t.Errorf("Expected removed file1, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(file2); string(data) != `{"v": 3}` {
+		t.Errorf("Expected staged file2, got %s", data)
+	}
+	if _, err := os.Stat(page1); !os.IsNotExist(err) {
+		t.Errorf("Expected page1 removed with its directory, got %v", err)
+	}
+	if data, _ := ioutil.ReadFile(page2); string(data) != `{"v": 4}` {
+		t.Errorf("Expected page2 staged in removed directory, got %s", data)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.merge-*"))
+	if len(files) != 0 {
+		t.Errorf("Expected no leftovers of commit, got %v", files)
+	}
+}
+
+func TestProcessFileMerge_Rollback(t *testing.T) {
+	srcDir, err := ioutil.TempDir("", "sketchmerge-src")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := ioutil.TempDir("", "sketchmerge-dst")
+	if err != nil {
+		t.Fatalf("Error occured %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	dstDoc := []byte(`{"name": "old", "layers": []}`)
+	mergeFile := filepath.Join(srcDir, "merge.json")
+	files := map[string][]byte{
+		filepath.Join(srcDir, "document.json"): []byte(`{"name": "new", "layers": []}`),
+		filepath.Join(dstDir, "document.json"): dstDoc,
+		filepath.Join(srcDir, "meta.json"): []byte(`{"app": "new"}`),
+		filepath.Join(dstDir, "meta.json"): []byte(`{"app": "old"}`),
+		mergeFile: []byte(`{"merge_actions": [
+			{"file_key": "document", "file_ext": ".json", "file_diff": {"src_to_dst_diff": {"$[\"name\"]": "$[\"name\"]"}}},
+			{"file_key": "meta", "file_ext": ".json", "file_diff": {"src_to_dst_diff": {"$[\"missing\"]": "$[\"missing\"]"}}}]}`),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatalf("Error occured %v", err)
+		}
+	}
+
+	report, err := ProcessFileMerge(mergeFile, srcDir, dstDir, "", MergeOptions{})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if !report.HasFailures() || !report.RolledBack {
+		t.Errorf("Expected rolled back merge, got %v", report)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dstDir, "document.json"))
+	if err != nil || string(data) != string(dstDoc) {
+		t.Errorf("Expected document.json untouched after rollback, got %s %v", data, err)
+	}
+}
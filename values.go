@@ -0,0 +1,82 @@
+package sketchmerge
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+//Maximal size of json encoded subtree embedded into diff entry when MaxValueSize option is not set
+const DefaultMaxValueSize = 256
+
+//Values of the node in src and dst documents, large subtrees are given by their hashes
+//Merge makes dst the same as src, so dst value is the one before the merge and src value is the one after it
+type DiffValue struct {
+	SrcValue interface{} `json:"src_value"`
+	DstValue interface{} `json:"dst_value"`
+	SrcHash string `json:"src_hash,omitempty"`
+	DstHash string `json:"dst_hash,omitempty"`
+}
+
+//Gets sha256 hash of json encoded subtree, the same hash as of fingerprints
+func subtreeHash(v interface{}) (string, []byte) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", nil
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), data
+}
+
+//Gets value to embed into diff entry, or hash of the value if its subtree is larger than maxSize
+func (jsc * JsonStructureCompare) embeddedValue(doc map[string]interface{}, path string) (interface{}, string) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, ""
+	}
+
+	value, err := p.Resolve(doc)
+	if err != nil {
+		return nil, ""
+	}
+
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return value, ""
+	}
+
+	maxSize := jsc.Options.MaxValueSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxValueSize
+	}
+
+	hash, data := subtreeHash(value)
+	if len(data) > maxSize {
+		return nil, hash
+	}
+	return value, ""
+}
+
+//Embeds values of doc1 and doc2 into entries of src to dst differences
+func (jsc * JsonStructureCompare) addDiffValues(doc1 map[string]interface{}, doc2 map[string]interface{}) {
+	jsc.DiffValues = make(map[string]DiffValue, len(jsc.Doc1Diffs))
+
+	for key, item := range jsc.Doc1Diffs {
+		var diffValue DiffValue
+		switch {
+		case isDeleteDiff(key):
+			//node exists only in dst and is deleted by merge
+			diffValue.DstValue, diffValue.DstHash = jsc.embeddedValue(doc2, key)
+		case isAddDiff(key):
+			//node exists only in src and is added by merge
+			diffValue.SrcValue, diffValue.SrcHash = jsc.embeddedValue(doc1, key)
+		default:
+			diffValue.SrcValue, diffValue.SrcHash = jsc.embeddedValue(doc1, key)
+			if dstPath, ok := item.(string); ok {
+				diffValue.DstValue, diffValue.DstHash = jsc.embeddedValue(doc2, dstPath)
+			}
+		}
+		jsc.DiffValues[key] = diffValue
+	}
+}
@@ -0,0 +1,64 @@
+package sketchmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJsonStructureCompare_DiffValues(t *testing.T) {
+	var jsonDoc1, jsonDoc2 map[string]interface{}
+	err1 := json.Unmarshal([]byte(`{"name": "old", "frame": {"x": 1, "y": 2},
+		"layers": [{"do_objectID": "A", "name": "added"}], "style": {"blur": 1}}`), &jsonDoc1)
+	err2 := json.Unmarshal([]byte(`{"name": "new", "frame": {"x": 1, "y": 3},
+		"layers": [], "shadow": {"color": "#000000"}, "style": {"blur": 1}}`), &jsonDoc2)
+
+	if err1 != nil || err2 != nil {
+		t.Fatalf("Error occured %v %v", err1, err2)
+	}
+
+	jsCompare := NewJsonStructureCompare()
+	jsCompare.Options.WithValues = true
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	if v := jsCompare.DiffValues[`$["name"]`]; v.SrcValue != "old" || v.DstValue != "new" {
+		t.Errorf("Unexpected values of name change %v", v)
+	}
+
+	if v := jsCompare.DiffValues[`$["frame"]["y"]`]; v.SrcValue != 2.0 || v.DstValue != 3.0 {
+		t.Errorf("Unexpected values of frame change %v", v)
+	}
+
+	if v := jsCompare.DiffValues[`-$["shadow"]`]; v.SrcValue != nil || !reflect.DeepEqual(v.DstValue, jsonDoc2["shadow"]) {
+		t.Errorf("Unexpected values of deleted node %v", v)
+	}
+
+	if v := jsCompare.DiffValues[`+$["layers"][0]`]; v.DstValue != nil || !reflect.DeepEqual(v.SrcValue, jsonDoc1["layers"].([]interface{})[0]) {
+		t.Errorf("Unexpected values of added node %v", v)
+	}
+
+	//node added by merge is labeled by the document it comes from
+	data, _ := json.Marshal(jsCompare.DiffValues[`+$["layers"][0]`])
+	if string(data) != `{"src_value":{"do_objectID":"A","name":"added"},"dst_value":null}` {
+		t.Errorf("Unexpected labels of added node values %s", data)
+	}
+
+	jsCompare = NewJsonStructureCompare()
+	jsCompare.Options.WithValues = true
+	jsCompare.Options.MaxValueSize = 8
+	jsCompare.Compare(jsonDoc1, jsonDoc2, "$")
+
+	v := jsCompare.DiffValues[`-$["shadow"]`]
+	hash, _ := subtreeHash(jsonDoc2["shadow"])
+	if v.DstValue != nil || v.DstHash != hash {
+		t.Errorf("Expected hash %v of large subtree, got %v", hash, v)
+	}
+
+	if v := jsCompare.DiffValues[`$["name"]`]; v.SrcValue != "old" || v.SrcHash != "" {
+		t.Errorf("Scalar values should be embedded %v", v)
+	}
+
+	if len(jsCompare.DiffValues) != len(jsCompare.Doc1Diffs) {
+		t.Errorf("Expected values for each diff %v", jsCompare.DiffValues)
+	}
+}